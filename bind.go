@@ -0,0 +1,113 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// A bindField is a struct field filled by Bind.
+type bindField struct {
+	index []int  // index is the field index sequence, for reflect.Value.FieldByIndex.
+	name  string // name is the field name.
+	param string // param is the parameter name, from the "path" tag.
+}
+
+// bindFields caches the bindFields of struct types.
+var bindFields sync.Map
+
+// structBindFields returns the fields of struct type t tagged with "path".
+// Fields of embedded structs are included.
+func structBindFields(t reflect.Type) []bindField {
+	if fields, ok := bindFields.Load(t); ok {
+		return fields.([]bindField)
+	}
+	var fields []bindField
+	for _, f := range reflect.VisibleFields(t) {
+		param, ok := f.Tag.Lookup("path")
+		if !ok || param == "" || param == "-" || !f.IsExported() {
+			continue
+		}
+		fields = append(fields, bindField{index: f.Index, name: f.Name, param: param})
+	}
+	bindFields.Store(t, fields)
+	return fields
+}
+
+// Bind fills the fields of the struct pointed by dst with the path parameters named by their "path" tag, like:
+//
+//	var params struct {
+//		ID   int64     `path:"id"`
+//		Day  time.Time `path:"day"`
+//		Slug string    `path:"slug"`
+//	}
+//	err := router.Bind(r, &params)
+//
+// Values are converted like with ParameterAs.
+// A field whose parameter is missing (like an absent optional parameter) is left untouched.
+//
+// The error is a *BindError listing every field that can't be converted.
+// It panics if dst is not a pointer to a struct, or if a tagged field type can't be converted.
+func Bind(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		panic(fmt.Errorf("router: Bind needs a pointer to a struct, got %T", dst))
+	}
+	v = v.Elem()
+	var bindErr *BindError
+	for _, f := range structBindFields(v.Type()) {
+		s, ok := lookupParameter(r, f.param)
+		if !ok {
+			continue
+		}
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil { // Field of a nil embedded struct pointer.
+			continue
+		}
+		if err = convertValue(fv, s); err != nil {
+			if bindErr == nil {
+				bindErr = new(BindError)
+			}
+			bindErr.Errors = append(bindErr.Errors, &ParameterError{Name: f.param, Field: f.name, Pattern: Pattern(r), Value: s, Type: fv.Type().String(), Err: err})
+		}
+	}
+	if bindErr != nil {
+		return bindErr
+	}
+	return nil
+}
+
+// Typed returns a handler binding the path parameters into a new T (a struct) with Bind, and calling h with it.
+// If binding fails, the client gets a 400 Bad Request response with the error.
+//
+// Example:
+//
+//	type userParams struct {
+//		ID int64 `path:"id"`
+//	}
+//
+//	rt.Get("/users/:id", router.Typed(func(w http.ResponseWriter, r *http.Request, p userParams) {
+//		fmt.Fprintf(w, "Page of user #%d", p.ID)
+//	}))
+//
+// It panics if T is not a struct, or if a tagged field type can't be converted, so a mistake shows when making the route rather than when serving it.
+func Typed[T any](h func(http.ResponseWriter, *http.Request, T)) http.Handler {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Errorf("router: Typed needs a struct type, got %s", t))
+	}
+	for _, f := range structBindFields(t) {
+		if ft := t.FieldByIndex(f.index).Type; !canConvert(ft) {
+			panic(fmt.Errorf("router: no parser for type %s of field %s", ft, f.name))
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params T
+		if err := Bind(r, &params); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h(w, r, params)
+	})
+}
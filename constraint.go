@@ -0,0 +1,135 @@
+package router
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A constraint is a named matcher for parameter values, set in a route path like ":id|int".
+type constraint struct {
+	name  string
+	match func(string) bool
+}
+
+var (
+	constraintsMu sync.RWMutex
+	constraints   = map[string]*constraint{
+		"int":  {name: "int", match: isInt},
+		"uuid": {name: "uuid", match: isUUID},
+		"slug": {name: "slug", match: isSlug},
+		"date": {name: "date", match: isDate},
+		"hex":  {name: "hex", match: isHex},
+	}
+)
+
+// RegisterConstraint makes match usable as a parameter constraint named name, like in "/users/:id|name".
+// The built-in constraints are "int", "uuid", "slug", "date" (like "2006-01-02") and "hex".
+// It panics if name is not made of ASCII letters, digits and "_", or is already registered.
+// Routes using a constraint must be made after its registration.
+func RegisterConstraint(name string, match func(value string) bool) {
+	for i := 0; i < len(name); i++ {
+		if !isNameByte(name[i]) {
+			panic(fmt.Errorf("router: constraint name %q must be made of ASCII letters, digits and %q", name, "_"))
+		}
+	}
+	if name == "" || match == nil {
+		panic(fmt.Errorf("router: constraint %q must have a name and a match function", name))
+	}
+	constraintsMu.Lock()
+	defer constraintsMu.Unlock()
+	if _, ok := constraints[name]; ok {
+		panic(fmt.Errorf("router: constraint %q already registered", name))
+	}
+	constraints[name] = &constraint{name: name, match: match}
+}
+
+// lookupConstraint returns the constraint registered as name, or nil.
+func lookupConstraint(name string) *constraint {
+	constraintsMu.RLock()
+	defer constraintsMu.RUnlock()
+	return constraints[name]
+}
+
+// isInt tells if s is a decimal integer, with an optional "-" sign.
+func isInt(s string) bool {
+	if len(s) > 1 && s[0] == '-' {
+		s = s[1:]
+	}
+	return isDigits(s)
+}
+
+// isDigits tells if s is a non-empty string of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isHex tells if s is a non-empty string of hexadecimal digits, in any case.
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isHexByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexByte(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// isUUID tells if s is a UUID in its canonical form, like "123e4567-e89b-12d3-a456-426614174000" (in any case).
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHexByte(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isSlug tells if s is made of lowercase ASCII letters and digits, possibly separated by single hyphens.
+func isSlug(s string) bool {
+	if s == "" || s[0] == '-' || s[len(s)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '-' && s[i-1] != '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isDate tells if s is a date like "2006-01-02", with a month between 01 and 12 and a day between 01 and 31.
+func isDate(s string) bool {
+	if len(s) != 10 || s[4] != '-' || s[7] != '-' || !isDigits(s[:4]) || !isDigits(s[5:7]) || !isDigits(s[8:]) {
+		return false
+	}
+	month := (s[5]-'0')*10 + s[6] - '0'
+	day := (s[8]-'0')*10 + s[9] - '0'
+	return month >= 1 && month <= 12 && day >= 1 && day <= 31
+}
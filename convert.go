@@ -0,0 +1,230 @@
+package router
+
+import (
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A UUID is a universally unique identifier, as returned by ParameterUUID.
+type UUID [16]byte
+
+// String returns the UUID in its canonical form, like "123e4567-e89b-12d3-a456-426614174000".
+func (u UUID) String() string {
+	b := make([]byte, 36)
+	hex.Encode(b, u[:4])
+	b[8] = '-'
+	hex.Encode(b[9:], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b)
+}
+
+// parseUUID parses a UUID in its canonical form (in any case).
+func parseUUID(s string) (u UUID, err error) {
+	if !isUUID(s) {
+		return u, errors.New("invalid syntax")
+	}
+	var b [32]byte
+	copy(b[:], s[:8])
+	copy(b[8:], s[9:13])
+	copy(b[12:], s[14:18])
+	copy(b[16:], s[19:23])
+	copy(b[20:], s[24:])
+	_, err = hex.Decode(u[:], b[:])
+	return
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[reflect.Type]interface{}{
+		reflect.TypeFor[string](): func(s string) (string, error) { return s, nil },
+		reflect.TypeFor[int]():    strconv.Atoi,
+		reflect.TypeFor[int64](): func(s string) (int64, error) {
+			return strconv.ParseInt(s, 10, 64)
+		},
+		reflect.TypeFor[uint](): func(s string) (uint, error) {
+			v, err := strconv.ParseUint(s, 10, 0)
+			return uint(v), err
+		},
+		reflect.TypeFor[uint64](): func(s string) (uint64, error) {
+			return strconv.ParseUint(s, 10, 64)
+		},
+		reflect.TypeFor[float64](): func(s string) (float64, error) {
+			return strconv.ParseFloat(s, 64)
+		},
+		reflect.TypeFor[bool]():      strconv.ParseBool,
+		reflect.TypeFor[UUID]():      parseUUID,
+		reflect.TypeFor[time.Time](): parseTime,
+	}
+)
+
+// parseTime parses a date like "2006-01-02" (in UTC), or a time in the RFC 3339 format.
+func parseTime(s string) (time.Time, error) {
+	if len(s) == len(time.DateOnly) {
+		return time.Parse(time.DateOnly, s)
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// RegisterParser makes parse used by ParameterAs to convert parameter values to type T, replacing any previous parser for T (a nil parse removes it).
+// Parsers are provided for string, int, int64, uint, uint64, float64, bool, UUID and time.Time (a date like "2006-01-02", or a RFC 3339 time).
+// Types implementing encoding.TextUnmarshaler (with a pointer receiver) don't need one.
+func RegisterParser[T any](parse func(string) (T, error)) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[reflect.TypeFor[T]()] = parse
+}
+
+// lookupParser returns the parser registered for type T, or nil.
+func lookupParser[T any]() func(string) (T, error) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	parse, _ := parsers[reflect.TypeFor[T]()].(func(string) (T, error))
+	return parse
+}
+
+// ParameterAs returns the value of path parameter, converted to type T with the parser registered by RegisterParser, or with its encoding.TextUnmarshaler implementation.
+// Otherwise, types of a string, integer, float or bool kind are converted with package strconv.
+// The error is a *ParameterError if the parameter is missing or can't be converted.
+// It panics if there is no way to convert to T.
+//
+// Example:
+//
+//	id, err := router.ParameterAs[int64](r, "id")
+func ParameterAs[T any](r *http.Request, key string) (v T, err error) {
+	s, ok := lookupParameter(r, key)
+	if !ok {
+		return v, &ParameterError{Name: key, Pattern: Pattern(r), Type: reflect.TypeFor[T]().String(), Err: ErrMissingParameter}
+	}
+	if parse := lookupParser[T](); parse != nil {
+		v, err = parse(s)
+	} else {
+		err = convertValue(reflect.ValueOf(&v).Elem(), s)
+	}
+	if err != nil {
+		return v, &ParameterError{Name: key, Pattern: Pattern(r), Value: s, Type: reflect.TypeFor[T]().String(), Err: numErrCause(err)}
+	}
+	return v, nil
+}
+
+// convertValue converts s to the type of v (settable) and sets it, like ParameterAs.
+// It panics if there is no way to convert to this type.
+func convertValue(v reflect.Value, s string) error {
+	if parse := parserValue(v.Type()); parse.IsValid() {
+		out := parse.Call([]reflect.Value{reflect.ValueOf(s)})
+		if err, _ := out[1].Interface().(error); err != nil {
+			return numErrCause(err)
+		}
+		v.Set(out[0])
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return numErrCause(err)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return numErrCause(err)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return numErrCause(err)
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return numErrCause(err)
+		}
+		v.SetBool(b)
+	default:
+		panic(fmt.Errorf("router: no parser for type %s", v.Type()))
+	}
+	return nil
+}
+
+// canConvert tells if convertValue can convert to type t.
+func canConvert(t reflect.Type) bool {
+	if parserValue(t).IsValid() || reflect.PointerTo(t).Implements(reflect.TypeFor[encoding.TextUnmarshaler]()) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// parserValue returns the parser registered for type t, or an invalid value if there is none.
+func parserValue(t reflect.Type) reflect.Value {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	if parse := reflect.ValueOf(parsers[t]); parse.IsValid() && !parse.IsNil() {
+		return parse
+	}
+	return reflect.Value{}
+}
+
+// numErrCause returns the cause of err if it's a *strconv.NumError, as the value is already part of a ParameterError.
+// Otherwise, err is returned.
+func numErrCause(err error) error {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		return numErr.Err
+	}
+	return err
+}
+
+// ParameterInt returns the value of path parameter as an int.
+// The error is a *ParameterError if the parameter is missing or is not a valid int.
+func ParameterInt(r *http.Request, key string) (int, error) {
+	return ParameterAs[int](r, key)
+}
+
+// ParameterInt64 returns the value of path parameter as an int64.
+// The error is a *ParameterError if the parameter is missing or is not a valid int64.
+func ParameterInt64(r *http.Request, key string) (int64, error) {
+	return ParameterAs[int64](r, key)
+}
+
+// ParameterUint returns the value of path parameter as an uint.
+// The error is a *ParameterError if the parameter is missing or is not a valid uint.
+func ParameterUint(r *http.Request, key string) (uint, error) {
+	return ParameterAs[uint](r, key)
+}
+
+// ParameterBool returns the value of path parameter as a bool, accepting the values of strconv.ParseBool.
+// The error is a *ParameterError if the parameter is missing or is not a valid bool.
+func ParameterBool(r *http.Request, key string) (bool, error) {
+	return ParameterAs[bool](r, key)
+}
+
+// ParameterUUID returns the value of path parameter as a UUID, from its canonical form.
+// The error is a *ParameterError if the parameter is missing or is not a valid UUID.
+func ParameterUUID(r *http.Request, key string) (UUID, error) {
+	return ParameterAs[UUID](r, key)
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MarshalJSON returns the route trees by method, for debugging or comparing route tables.
+// Each node has its path segment, parameter names, regular expression, constraint, handler type, route pattern, root flag and children.
+func (rt *Router) MarshalJSON() ([]byte, error) {
+	trees := make(map[string][]*node, len(rt.trees))
+	for method, n := range rt.trees {
+		trees[method] = n.children
+	}
+	return json.Marshal(trees)
+}
+
+// MarshalJSON returns the node and its children.
+func (n *node) MarshalJSON() ([]byte, error) {
+	jn := struct {
+		S          string   `json:"s"`
+		Params     []string `json:"params,omitempty"`
+		Regexp     string   `json:"regexp,omitempty"`
+		Constraint string   `json:"constraint,omitempty"`
+		Handler    string   `json:"handler,omitempty"`
+		Pattern    string   `json:"pattern,omitempty"`
+		IsRoot     bool     `json:"isRoot,omitempty"`
+		Children   []*node  `json:"children,omitempty"`
+	}{
+		S:        n.s,
+		Params:   n.params,
+		Pattern:  n.pattern,
+		IsRoot:   n.isRoot,
+		Children: n.children,
+	}
+	if n.re != nil {
+		jn.Regexp = n.re.String()
+	}
+	if n.constraint != nil {
+		jn.Constraint = n.constraint.name
+	}
+	if n.handler != nil {
+		jn.Handler = fmt.Sprintf("%T", n.handler)
+	}
+	return json.Marshal(jn)
+}
+
+// DOT returns the route trees in the Graphviz DOT language, to visualize them.
+// A node having a handler is drawn in bold, with its route pattern.
+func (rt *Router) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph router {\n\tnode [shape=box];\n")
+	var id int
+	for _, method := range rt.methods() {
+		fmt.Fprintf(&b, "\tn%d [label=\"%s\", shape=ellipse];\n", id, dotEscape(method))
+		parent := id
+		id++
+		for _, n := range rt.trees[method].children {
+			id = n.dot(&b, parent, id)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dot writes the node with identifier id and its edge from parent, followed by its children.
+// It returns the next free identifier.
+func (n *node) dot(b *strings.Builder, parent, id int) int {
+	label := dotEscape(n.s)
+	if n.re != nil {
+		label += `\n` + dotEscape(n.re.String())
+	}
+	if n.constraint != nil {
+		label += `\n|` + dotEscape(n.constraint.name)
+	}
+	var style string
+	if n.handler != nil {
+		label += `\n` + dotEscape(n.pattern) + `\n` + dotEscape(fmt.Sprintf("%T", n.handler))
+		style = ", style=bold"
+	}
+	fmt.Fprintf(b, "\tn%d [label=\"%s\"%s];\n\tn%d -> n%d;\n", id, label, style, parent, id)
+	self := id
+	id++
+	for _, child := range n.children {
+		id = child.dot(b, self, id)
+	}
+	return id
+}
+
+// dotEscape escapes s for a DOT quoted string.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
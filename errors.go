@@ -0,0 +1,95 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A PatternError is returned when a route path is malformed.
+type PatternError struct {
+	Pattern string
+	Reason  string // Reason tells what's wrong, like "has anonymous parameter".
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("router: path %q %s", e.Pattern, e.Reason)
+}
+
+// A RegexpError is returned when a parameter regular expression of a route path can't be compiled.
+type RegexpError struct {
+	Pattern string
+	Regexp  string
+	Err     error
+}
+
+func (e *RegexpError) Error() string {
+	return fmt.Sprintf("router: path %q has invalid regular expression %q: %v", e.Pattern, e.Regexp, e.Err)
+}
+
+// Unwrap returns the compilation error.
+func (e *RegexpError) Unwrap() error {
+	return e.Err
+}
+
+// A DuplicateRouteError is returned when a route path matches exactly the same requests as an existing route, for the same method.
+type DuplicateRouteError struct {
+	Method   string
+	Pattern  string
+	Existing string // Existing is the pattern of the route already made.
+}
+
+func (e *DuplicateRouteError) Error() string {
+	return fmt.Sprintf("router: two or more routes have same path: %s %q and %q", e.Method, e.Existing, e.Pattern)
+}
+
+// ErrMissingParameter is the cause of a ParameterError when the parameter is not part of the matched route, or is an absent optional one.
+var ErrMissingParameter = errors.New("missing parameter")
+
+// A ParameterError is returned when a path parameter can't be converted to the wanted type.
+type ParameterError struct {
+	Name    string
+	Field   string // Field is the struct field name, for an error from Bind.
+	Pattern string // Pattern is the path of the matched route.
+	Value   string
+	Type    string // Type is the name of the wanted type, like "int".
+	Err     error  // Err is the conversion error, or ErrMissingParameter.
+}
+
+func (e *ParameterError) Error() string {
+	if e.Err == ErrMissingParameter {
+		return fmt.Sprintf("router: path %q has no parameter %q", e.Pattern, e.Name)
+	}
+	return fmt.Sprintf("router: path %q has invalid %s value %q for parameter %q: %v", e.Pattern, e.Type, e.Value, e.Name, e.Err)
+}
+
+// Unwrap returns the conversion error.
+func (e *ParameterError) Unwrap() error {
+	return e.Err
+}
+
+// A BindError is returned by Bind when some parameters can't be converted to their field type.
+type BindError struct {
+	Errors []*ParameterError // Errors are the conversion errors, in the order of the fields.
+}
+
+func (e *BindError) Error() string {
+	var b strings.Builder
+	b.WriteString("router: can't bind parameters: ")
+	for i, err := range e.Errors {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "field %s: %s", err.Field, strings.TrimPrefix(err.Error(), "router: "))
+	}
+	return b.String()
+}
+
+// Unwrap returns the conversion errors.
+func (e *BindError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,113 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// A Group makes routes sharing a path prefix and middlewares.
+// It only exists at registration time: routes are added to the router with their full path and wrapped handler.
+type Group struct {
+	rt          *Router
+	parent      *Group
+	prefix      string // prefix is relative to the parent group.
+	middlewares []func(http.Handler) http.Handler
+}
+
+// Group returns a group of routes whose paths begin with prefix.
+// A trailing slash in prefix is ignored.
+func (rt *Router) Group(prefix string) *Group {
+	return &Group{rt: rt, prefix: groupPrefix(prefix)}
+}
+
+// Group returns a subgroup of routes whose paths begin with the group prefix followed by prefix.
+// The subgroup routes are also wrapped by the group middlewares.
+func (g *Group) Group(prefix string) *Group {
+	return &Group{rt: g.rt, parent: g, prefix: groupPrefix(prefix)}
+}
+
+// groupPrefix checks prefix and returns it without trailing slash.
+func groupPrefix(prefix string) string {
+	if len(prefix) == 0 || prefix[0] != '/' {
+		panic(fmt.Errorf("router: group prefix %q must begin with %q", prefix, "/"))
+	}
+	for len(prefix) > 0 && prefix[len(prefix)-1] == '/' {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
+}
+
+// Use adds middlewares wrapping the handlers of the group routes made afterwards, inside the middlewares of the parent groups and router.
+// The first middleware is the outermost one.
+func (g *Group) Use(middlewares ...func(http.Handler) http.Handler) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+// path returns the full route path for a path relative to the group.
+// An empty path stands for the group prefix itself.
+func (g *Group) path(path string) string {
+	if path == "" && g.prefix != "" {
+		return g.prefix
+	}
+	if len(path) == 0 || path[0] != '/' {
+		panic(fmt.Errorf("router: path %q must begin with %q", path, "/"))
+	}
+	return g.prefix + path
+}
+
+// Handle adds a route with method, path (relative to the group) and handler.
+func (g *Group) Handle(method, path string, handler http.Handler) {
+	g.handle("", method, path, handler)
+}
+
+// HandleNamed adds a named route with method, path (relative to the group) and handler.
+func (g *Group) HandleNamed(name, method, path string, handler http.Handler) {
+	g.handle(name, method, path, handler)
+}
+
+// HandlePattern adds a route from a http.ServeMux-style pattern made of a method and a path (relative to the group), like "GET /users/{id}".
+func (g *Group) HandlePattern(pattern string, handler http.Handler) {
+	method, path, err := splitPattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	g.handle("", method, path, handler)
+}
+
+// handle prefixes path and wraps handler for the group, and passes them to the parent group or router.
+func (g *Group) handle(name, method, path string, handler http.Handler) {
+	path = g.path(path)
+	handler = chain(g.middlewares, handler)
+	if g.parent != nil {
+		g.parent.handle(name, method, path, handler)
+	} else if name != "" {
+		g.rt.HandleNamed(name, method, path, handler)
+	} else {
+		g.rt.Handle(method, path, handler)
+	}
+}
+
+// Get makes a route for GET method.
+func (g *Group) Get(path string, handler http.Handler) {
+	g.Handle(http.MethodGet, path, handler)
+}
+
+// Post makes a route for POST method.
+func (g *Group) Post(path string, handler http.Handler) {
+	g.Handle(http.MethodPost, path, handler)
+}
+
+// Put makes a route for PUT method.
+func (g *Group) Put(path string, handler http.Handler) {
+	g.Handle(http.MethodPut, path, handler)
+}
+
+// Patch makes a route for PATCH method.
+func (g *Group) Patch(path string, handler http.Handler) {
+	g.Handle(http.MethodPatch, path, handler)
+}
+
+// Delete makes a route for DELETE method.
+func (g *Group) Delete(path string, handler http.Handler) {
+	g.Handle(http.MethodDelete, path, handler)
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// headResponseWriter discards the body written by a GET handler serving a HEAD request.
+// Sending the header is delayed until the handler returns (or flushes), so the Content-Length of the discarded body can be set.
+type headResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	length      int
+	wroteHeader bool // wroteHeader tells if the header has been sent to the underlying writer.
+}
+
+func (w *headResponseWriter) WriteHeader(status int) {
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols { // Informational responses are sent immediately.
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.length += len(b)
+	return len(b), nil
+}
+
+// Flush sends the header without Content-Length, as the handler is streaming.
+func (w *headResponseWriter) Flush() {
+	w.writeHeader(false)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish sends the header with the Content-Length of the discarded body, if not already sent.
+func (w *headResponseWriter) finish() {
+	w.writeHeader(true)
+}
+
+func (w *headResponseWriter) writeHeader(complete bool) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h := w.ResponseWriter.Header()
+	if complete && w.status != http.StatusNoContent && w.status != http.StatusNotModified && h.Get("Content-Length") == "" && h.Get("Transfer-Encoding") == "" {
+		h.Set("Content-Length", strconv.Itoa(w.length))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
@@ -0,0 +1,334 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// A ConflictKind is a kind of problem found in routes by Router.Lint.
+type ConflictKind int
+
+// Conflict kinds
+const (
+	ConflictUnreachable          ConflictKind = iota // ConflictUnreachable is a route whose requests match no route at all.
+	ConflictShadowedParameter                        // ConflictShadowedParameter is a route whose parameter values are all taken by another parameter on the same level, sorted before.
+	ConflictWildcardEclipse                          // ConflictWildcardEclipse is a route whose requests are taken by a wildcard route.
+	ConflictUnanchoredRegexp                         // ConflictUnanchoredRegexp is a route having a parameter regular expression not anchored with "^" and "$", so it matches any value containing it.
+	ConflictOverlappingParameter                     // ConflictOverlappingParameter is a route whose parameter values are partly taken by another parameter on the same level, sorted before. It's often the intended priority, so it's only a warning.
+)
+
+func (k ConflictKind) String() string {
+	switch k {
+	case ConflictUnreachable:
+		return "unreachable"
+	case ConflictShadowedParameter:
+		return "shadowed parameter"
+	case ConflictWildcardEclipse:
+		return "wildcard eclipse"
+	case ConflictUnanchoredRegexp:
+		return "unanchored regexp"
+	case ConflictOverlappingParameter:
+		return "overlapping parameter"
+	}
+	return fmt.Sprintf("ConflictKind(%d)", int(k))
+}
+
+// A Conflict is a problem found in routes by Router.Lint.
+type Conflict struct {
+	Kind    ConflictKind
+	Method  string
+	Pattern string // Pattern is the route having the problem.
+	Other   string // Other is the route taking the requests, if any.
+	Regexp  string // Regexp is the unanchored regular expression, for ConflictUnanchoredRegexp.
+}
+
+func (c Conflict) String() string {
+	s := fmt.Sprintf("router: %s %s: %s", c.Method, c.Pattern, c.Kind)
+	if c.Other != "" {
+		s += fmt.Sprintf(" by %s", c.Other)
+	}
+	if c.Regexp != "" {
+		s += fmt.Sprintf(" %q", c.Regexp)
+	}
+	return s
+}
+
+// Lint checks all the routes and returns the problems found, sorted by method and pattern.
+// Each route is tried with sample request paths (using values accepted by its parameters, with one for each alternative and optional part of a regular expression) to find the ones not reaching it.
+// A parameter is only reported as shadowed when none of its samples reach it.
+// When some of them do, it's reported as overlapping, which is often the intended priority.
+// A parameter without constraint nor regular expression is only reported when another one takes any value (like ":any:^.+$"), so "/users/:id|int" before "/users/:name" is fine.
+//
+// It's meant to be used in a test:
+//
+//	for _, c := range rt.Lint() {
+//		if c.Kind != router.ConflictOverlappingParameter {
+//			t.Error(c)
+//		}
+//	}
+func (rt *Router) Lint() (conflicts []Conflict) {
+	for _, method := range rt.methods() {
+		root := rt.trees[method]
+		for _, n := range root.sortedRoutes() {
+			tokens, _ := parsePath(n.pattern)
+			for _, t := range tokens {
+				if t.re != nil && !isAnchored(t.re) {
+					conflicts = append(conflicts, Conflict{Kind: ConflictUnanchoredRegexp, Method: method, Pattern: n.pattern, Regexp: t.re.String()})
+				}
+			}
+
+			samples := make([][]string, len(tokens))
+			for i, t := range tokens {
+				if t.param {
+					if samples[i] = paramSamples(t); samples[i] == nil { // No sample for this regular expression: route can't be checked.
+						samples = nil
+						break
+					}
+				}
+			}
+			if samples == nil {
+				continue
+			}
+			c, found, reached := lintSamples(root, n, tokens, samples)
+			if !found {
+				continue
+			}
+			if reached { // Other values still reach the route: it's not proven shadowed.
+				if c.Kind != ConflictShadowedParameter {
+					continue
+				}
+				c.Kind = ConflictOverlappingParameter
+			}
+			c.Method = method
+			conflicts = append(conflicts, c)
+		}
+	}
+	return
+}
+
+// lintSamples tries the request paths made from tokens and all the samples of each parameter (the others keeping their first one) on root.
+// It returns the first conflict found, if any, and tells if some paths still reach route node n.
+func lintSamples(root, n *node, tokens []token, samples [][]string) (c Conflict, found, reached bool) {
+	values := make([]string, len(tokens))
+	for i, vs := range samples {
+		if vs != nil {
+			values[i] = vs[0]
+		}
+	}
+	c, reached = lintSample(root, n, tokens, values)
+	found = !reached
+	for i, vs := range samples {
+		if len(vs) < 2 {
+			continue
+		}
+		for _, v := range vs[1:] {
+			values[i] = v
+			if other, ok := lintSample(root, n, tokens, values); ok {
+				reached = true
+			} else if !found {
+				c, found = other, true
+			}
+		}
+		values[i] = vs[0]
+	}
+	return
+}
+
+// lintSample tries the request path made from tokens and values on root, and tells if it reaches route node n.
+// Being taken by a static route (without parameters) is fine, as static routes always take precedence.
+// Otherwise, the conflict is returned (without method).
+func lintSample(root, n *node, tokens []token, values []string) (Conflict, bool) {
+	got, _ := root.findChild(samplePath(tokens, values), nil)
+	if got == n || got != nil && got.handler != nil && !hasNamedParams(got) && hasNamedParams(n) {
+		return Conflict{}, true
+	}
+	c := Conflict{Pattern: n.pattern}
+	switch {
+	case got == nil || got.handler == nil:
+		c.Kind = ConflictUnreachable
+	case !got.isRoot && got.isWildcard():
+		c.Kind, c.Other = ConflictWildcardEclipse, got.pattern
+	default:
+		c.Kind, c.Other = ConflictShadowedParameter, got.pattern
+	}
+	return c, false
+}
+
+// samplePath returns a request path made from tokens, with values for parameters.
+func samplePath(tokens []token, values []string) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		switch {
+		case t.param:
+			b.WriteString(values[i])
+		case !t.wildcard: // The wildcard sample is empty.
+			b.WriteString(t.s)
+		}
+	}
+	return b.String()
+}
+
+// paramSamples returns values accepted by the parameter token t, or nil if none is found.
+// For a regular expression, there is a sample for each alternative and optional part (up to maxSamples).
+// A parameter without constraint nor regular expression gets a value no static route can have.
+func paramSamples(t token) (samples []string) {
+	if t.constraint != nil {
+		for _, v := range constraintSamples {
+			if t.constraint.match(v) {
+				samples = append(samples, v)
+			}
+		}
+		return
+	}
+	if t.re == nil {
+		return []string{"\x00"}
+	}
+	re, err := syntax.Parse(t.re.String(), syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	for _, v := range append(regexpSamples(re), "0", "a") { // An empty sample is not a parameter value: also try common ones.
+		if v != "" && t.re.MatchString(v) && !containsString(samples, v) {
+			samples = append(samples, v)
+		}
+	}
+	return
+}
+
+// constraintSamples are values tried on constraints, to find the ones they accept.
+var constraintSamples = []string{"0", "a", "a0", "2006-01-02", "00000000-0000-0000-0000-000000000000", "true"}
+
+// maxSamples is the maximum number of samples made from a regular expression.
+const maxSamples = 16
+
+// regexpSamples returns short strings matched by re, without "/": one for each alternative and optional part, up to maxSamples.
+// It returns nil if re has an unsupported operator.
+func regexpSamples(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText:
+		return []string{""}
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if r == '/' {
+				return nil
+			}
+		}
+		return []string{string(re.Rune)}
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			r := re.Rune[i]
+			if r == '/' {
+				r++
+			}
+			if r <= re.Rune[i+1] {
+				return []string{string(r)}
+			}
+		}
+		return nil
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return []string{"a"}
+	case syntax.OpCapture, syntax.OpPlus:
+		return regexpSamples(re.Sub[0])
+	case syntax.OpStar, syntax.OpQuest:
+		return appendSamples([]string{""}, regexpSamples(re.Sub[0]))
+	case syntax.OpRepeat:
+		samples := []string{""}
+		for i := 0; i < re.Min; i++ {
+			if samples = concatSamples(samples, regexpSamples(re.Sub[0])); samples == nil {
+				return nil
+			}
+		}
+		if re.Min == 0 {
+			samples = appendSamples(samples, regexpSamples(re.Sub[0]))
+		}
+		return samples
+	case syntax.OpConcat:
+		samples := []string{""}
+		for _, sub := range re.Sub {
+			if samples = concatSamples(samples, regexpSamples(sub)); samples == nil {
+				return nil
+			}
+		}
+		return samples
+	case syntax.OpAlternate:
+		var samples []string
+		for _, sub := range re.Sub {
+			samples = appendSamples(samples, regexpSamples(sub))
+		}
+		return samples
+	}
+	return nil
+}
+
+// concatSamples returns the concatenations of each prefix with each suffix, up to maxSamples, or nil if there is no suffix.
+func concatSamples(prefixes, suffixes []string) (samples []string) {
+	for _, p := range prefixes {
+		for _, s := range suffixes {
+			samples = appendSamples(samples, []string{p + s})
+		}
+	}
+	return
+}
+
+// appendSamples appends more samples to samples, without duplicates and up to maxSamples.
+func appendSamples(samples, more []string) []string {
+	for _, v := range more {
+		if len(samples) < maxSamples && !containsString(samples, v) {
+			samples = append(samples, v)
+		}
+	}
+	return samples
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isAnchored tells if re only matches whole values: it begins with "^" and ends with "$" (in all alternatives).
+func isAnchored(re *regexp.Regexp) bool {
+	s, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return false
+	}
+	return isAnchoredAt(s, 0, syntax.OpBeginText) && isAnchoredAt(s, -1, syntax.OpEndText)
+}
+
+// isAnchoredAt tells if re begins (with side 0) or ends (with side -1) with the op anchor.
+func isAnchoredAt(re *syntax.Regexp, side int, op syntax.Op) bool {
+	switch re.Op {
+	case op:
+		return true
+	case syntax.OpCapture:
+		return isAnchoredAt(re.Sub[0], side, op)
+	case syntax.OpConcat:
+		if side == 0 {
+			return isAnchoredAt(re.Sub[0], side, op)
+		}
+		return isAnchoredAt(re.Sub[len(re.Sub)-1], side, op)
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !isAnchoredAt(sub, side, op) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// hasNamedParams tells if route n has named parameters or a wildcard.
+func hasNamedParams(n *node) bool {
+	for _, name := range n.params {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
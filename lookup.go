@@ -0,0 +1,46 @@
+package router
+
+import "net/http"
+
+// A Match describes the outcome of routing a request, as reported by Router.Lookup.
+type Match struct {
+	Handler      http.Handler      // Handler is nil if no route matches.
+	Pattern      string            // Pattern is the path of the matched route, as given when making it.
+	Params       map[string]string // Params are the path parameters values, by name. The wildcard is named "*".
+	Methods      []string          // Methods are the sorted methods having a route for the path, like in an "Allow" header.
+	Redirect     string            // Redirect is the path the request would be redirected to, when no route matches.
+	RedirectCode int               // RedirectCode is the status code of the redirect, or 0 if there is none.
+}
+
+// Lookup returns what a request for method and path would be routed to, without serving it.
+// Path must be unescaped, like a request's URL.Path.
+// The boolean result tells if a route matches: otherwise, Match still reports the other methods and the redirect (trailing slash, fixed path or fixed case) the router would answer with.
+func (rt *Router) Lookup(method, path string) (Match, bool) {
+	var m Match
+	if rt.RedirectFixedPath && !isCleanPath(path) {
+		m.Redirect, m.RedirectCode = rt.redirection(method, path)
+		return m, false
+	}
+
+	n, values, _ := rt.route(method, path, nil)
+	if n == nil && rt.TrailingSlash == TrailingSlashServe && len(path) > 1 && path[len(path)-1] == '/' {
+		if n, values, _ = rt.route(method, path[:len(path)-1], nil); n != nil {
+			path = path[:len(path)-1]
+		}
+	}
+	m.Methods = rt.allowed(path, "")
+	if n == nil {
+		m.Redirect, m.RedirectCode = rt.redirection(method, path)
+		return m, false
+	}
+
+	m.Handler = n.handler
+	m.Pattern = n.pattern
+	if ps := n.appendParams(nil, values); len(ps) > 0 {
+		m.Params = make(map[string]string, len(ps))
+		for _, p := range ps {
+			m.Params[p.Name] = p.Value
+		}
+	}
+	return m, true
+}
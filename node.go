@@ -9,12 +9,16 @@ import (
 )
 
 type node struct {
-	s        string
-	params   map[string]uint16 // Parameter's names from the parent node to this one, and their path part index (between "/").
-	re       *regexp.Regexp
-	children []*node
-	handler  http.Handler
-	isRoot   bool // Need to know if node is root to not use it as wildcard.
+	s          string
+	params     []string // params are the parameter names of the route, in order ("" for an anonymous one, "*" for the wildcard).
+	re         *regexp.Regexp
+	constraint *constraint
+	match      func(string) bool // match is the constraint or regular expression matcher, if any.
+	delims     string            // delims are the first bytes of the static children not beginning with "/", that can end the parameter inside its segment.
+	children   []*node
+	handler    http.Handler
+	pattern    string // pattern is the route path given for handler.
+	isRoot     bool   // Need to know if node is root ("/") to not use it as wildcard.
 }
 
 func (n *node) string(prefix string) (s string) {
@@ -25,8 +29,11 @@ func (n *node) string(prefix string) (s string) {
 	if n.re != nil {
 		s = fmt.Sprintf("%s  %v", s, n.re)
 	}
+	if n.constraint != nil {
+		s = fmt.Sprintf("%s  |%s", s, n.constraint.name)
+	}
 	if n.handler != nil {
-		s = fmt.Sprintf("%s  %v", s, n.handler)
+		s = fmt.Sprintf("%s  %T", s, n.handler)
 	}
 	if n.isRoot {
 		s += "  root"
@@ -48,6 +55,11 @@ func (n *node) isWildcard() bool {
 	return isWildcard(n.s)
 }
 
+// accepts tells if v matches the parameter node constraint or regular expression, if any.
+func (n *node) accepts(v string) bool {
+	return n.match == nil || n.match(v)
+}
+
 // countChildren returns the number of children + grandchildren in node.
 func (n *node) countChildren() (i int) {
 	for _, n := range n.children {
@@ -57,109 +69,334 @@ func (n *node) countChildren() (i int) {
 	return
 }
 
-// makeChild adds a node to the tree.
-func (n *node) makeChild(path string, params map[string]uint16, re *regexp.Regexp, handler http.Handler, isRoot bool) {
-	defer n.sortChildren()
-NodesLoop:
+// routeNodes appends the nodes having a handler, in n and its children, to nodes.
+func (n *node) routeNodes(nodes []*node) []*node {
+	if n.handler != nil {
+		nodes = append(nodes, n)
+	}
 	for _, child := range n.children {
-		minlen := len(child.s)
-		if len(path) < minlen {
-			minlen = len(path)
+		nodes = child.routeNodes(nodes)
+	}
+	return nodes
+}
+
+// sortedRoutes returns the nodes having a handler in n and its children, sorted by pattern.
+// A route having an optional parameter is only returned once, with its longest node.
+func (n *node) sortedRoutes() []*node {
+	nodes := n.routeNodes(nil)
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].pattern != nodes[j].pattern {
+			return nodes[i].pattern < nodes[j].pattern
 		}
-		for i := 0; i < minlen; i++ {
-			if child.s[i] == path[i] {
-				continue
+		return len(nodes[i].params) > len(nodes[j].params)
+	})
+	routes := nodes[:0]
+	for i, n := range nodes {
+		if i == 0 || n.pattern != nodes[i-1].pattern {
+			routes = append(routes, n)
+		}
+	}
+	return routes
+}
+
+// add makes the nodes for the tokens of a route path, from n, and returns the last one.
+// All the nodes on the way are sorted again as their number of subnodes may have changed.
+func (n *node) add(tokens []token) *node {
+	way := []*node{n}
+	for _, t := range tokens {
+		if t.wildcard { // The wildcard is the trailing slash node.
+			continue
+		}
+		if t.param {
+			n = n.paramChild(t.re, t.constraint)
+			way = append(way, n)
+			continue
+		}
+		for s := t.s; s != ""; {
+			var i int
+			n, i = n.staticChild(s)
+			s = s[i:]
+			way = append(way, n)
+		}
+	}
+	for i := len(way) - 1; i >= 0; i-- {
+		way[i].sortChildren()
+		if way[i].isParameter() {
+			way[i].setDelims()
+		}
+	}
+	return n
+}
+
+// find returns the node of the route made from tokens, or nil if there is none.
+// Unlike add, it never changes the tree.
+func (n *node) find(tokens []token) *node {
+	for _, t := range tokens {
+		if t.wildcard {
+			continue
+		}
+		if t.param {
+			if n = n.sameParamChild(t.re, t.constraint); n == nil {
+				return nil
+			}
+			continue
+		}
+		for s := t.s; s != ""; s = s[len(n.s):] {
+			var next *node
+			for _, child := range n.children {
+				if !child.isParameter() && strings.HasPrefix(s, child.s) {
+					next = child
+					break
+				}
 			}
-			if i == 0 { // No match from the first byte: see next same-level node.
-				continue NodesLoop
+			if next == nil { // The node would have to be made or split.
+				return nil
 			}
-			// Difference in the middle of a node: split current node to make subnode and transfer handler to it.
-			*child = node{
-				s: child.s[:i],
-				children: []*node{
-					{s: child.s[i:], params: child.params, re: child.re, children: child.children, handler: child.handler},
-					{s: path[i:], params: params, re: re, handler: handler},
-				},
-			}
-			// BUG(arthurwhite): If the client has no route for "/" and this split occurs on the first level because of the 2nd byte (just after the leading "/"), the isRoot flag of the parent node ("/") is false.
-			// It's not a problem because it has no handler and will never match a request, but it's not clean.
-			// A first solution would be to let makeChild know the current level in tree, but... All that for this?
-			return
-		}
-		if len(path) < len(child.s) { // s fully matched first part of n.s: split node.
+			n = next
+		}
+	}
+	return n
+}
+
+// setDelims sets the delimiters of the parameter node from its static children.
+func (n *node) setDelims() {
+	n.delims = ""
+	for _, child := range n.children {
+		if !child.isParameter() && child.s[0] != '/' && strings.IndexByte(n.delims, child.s[0]) == -1 {
+			n.delims += child.s[:1]
+		}
+	}
+}
+
+// staticChild returns the static child matching the beginning of s, and the matched length.
+// The child is made if there is none, or split if s diverges or ends before its end.
+func (n *node) staticChild(s string) (*node, int) {
+	for _, child := range n.children {
+		if child.isParameter() || child.s[0] != s[0] {
+			continue
+		}
+		i := 1
+		for i < len(s) && i < len(child.s) && s[i] == child.s[i] {
+			i++
+		}
+		if i < len(child.s) { // Split child to make a subnode with its tail (and handler).
+			tail := *child
+			tail.s = child.s[i:]
+			tail.isRoot = false
 			*child = node{
-				s:      child.s[:len(path)],
-				params: params,
-				re:     re,
-				children: []*node{
-					{s: child.s[len(path):], params: child.params, re: child.re, children: child.children, handler: child.handler},
-				},
-				handler: handler,
-				isRoot:  isRoot,
-			}
-		} else if len(path) > len(child.s) { // n.s fully matched first part of s: see subnodes for the rest.
-			child.makeChild(path[len(child.s):], params, re, handler, false)
-		} else { // s == n.s and no rest: node has no handler or route is duplicated.
-			if handler == nil { // No handler provided (must be a non-ending path parameter): don't overwrite.
-				return
-			}
-			if child.handler != nil { // Handler provided but child.handler already set: it's a parameter with another re value, or route is duplicated.
-				if re == nil && child.re == nil || re != nil && child.re != nil && re.String() == child.re.String() {
-					panic("router: two or more routes have same path")
-				}
-				continue NodesLoop // It's a parameter with a different regular expression: check next child for "same path" error. Otherwise, node will be appended.
+				s:        child.s[:i],
+				children: []*node{&tail},
+				isRoot:   n.s == "" && i == 1 && s[0] == '/',
 			}
-			child.params = params
-			child.re = re
-			child.handler = handler
-			child.isRoot = isRoot
 		}
-		return
+		return child, i
 	}
-	n.children = append(n.children, &node{s: path, params: params, re: re, handler: handler, isRoot: isRoot}) // Not a single byte match on same-level nodes: append a new one.
+	child := &node{s: s, isRoot: n.s == "" && s == "/"}
+	n.children = append(n.children, child)
+	return child, len(s)
+}
+
+// paramChild returns the parameter child having the same regular expression as re and constraint as c, making it if there is none.
+// Parameters with different regular expressions or constraints need their own nodes as they don't match the same requests.
+func (n *node) paramChild(re *regexp.Regexp, c *constraint) *node {
+	if child := n.sameParamChild(re, c); child != nil {
+		return child
+	}
+	child := &node{s: ":", re: re, constraint: c}
+	if c != nil {
+		child.match = c.match
+	} else if re != nil {
+		child.match = re.MatchString
+	}
+	n.children = append(n.children, child)
+	return child
+}
+
+// sameParamChild returns the parameter child having the same regular expression as re and constraint as c, or nil.
+func (n *node) sameParamChild(re *regexp.Regexp, c *constraint) *node {
+	for _, child := range n.children {
+		if child.isParameter() && child.constraint == c && (child.re == nil && re == nil || child.re != nil && re != nil && child.re.String() == re.String()) {
+			return child
+		}
+	}
+	return nil
 }
 
 // findChild returns the deepest node matching path.
-func (n *node) findChild(path string) *node {
+// The parameter values met on the way are appended to values, in order, and returned.
+// For a wildcard, the rest of path is its value (missing if the wildcard node is fully matched).
+//
+// A parameter having delimiters first tries to end inside its segment, on the last delimiter leading to a route.
+// As trying all the delimiters takes polynomial time in the segment length, at most maxSplits of them are tried for the whole path.
+//
+// Parameters with different constraints or regular expressions have their own nodes (see paramChild), so when a parameter leads to no route, the next same-level parameter is tried.
+// This way, "/a/:x:^\d+$/b" doesn't hide "/a/:y" for "/a/5", like when they shared a node.
+func (n *node) findChild(path string, values []string) (*node, []string) {
+	splits := maxSplits
+	return n.findChildBounded(path, values, &splits)
+}
+
+// maxSplits is the maximum number of delimiters tried by parameters to end inside their segment, when matching a path.
+// Past it, parameters only take their whole segment.
+const maxSplits = 64
+
+// findChildBounded works like findChild, with splits as the number of in-segment splits that can still be tried.
+func (n *node) findChildBounded(path string, values []string, splits *int) (*node, []string) {
 	for _, n = range n.children {
 		if n.isParameter() {
 			paramEnd := strings.IndexByte(path, '/')
+			if paramEnd == 0 || len(path) == 0 { // A parameter can't be empty.
+				continue
+			}
+			if n.delims != "" {
+				segmentEnd := paramEnd
+				if segmentEnd == -1 {
+					segmentEnd = len(path)
+				}
+				for i := segmentEnd - 1; i > 0 && *splits > 0; i-- {
+					if strings.IndexByte(n.delims, path[i]) == -1 {
+						continue
+					}
+					if *splits--; !n.accepts(path[:i]) {
+						continue
+					}
+					if child, childValues := n.findChildBounded(path[i:], append(values, path[:i]), splits); child != nil && child.handler != nil {
+						return child, childValues
+					}
+				}
+			}
 			if paramEnd == -1 { // Path ends with the parameter.
-				if n.re != nil && !n.re.MatchString(path) {
+				if !n.accepts(path) || n.handler == nil {
 					continue
 				}
-				return n
+				return n, append(values, path)
 			}
-			if n.re != nil && !n.re.MatchString(path[:paramEnd]) {
+			if !n.accepts(path[:paramEnd]) {
 				continue
 			}
-			return n.findChild(path[paramEnd:])
+			child, childValues := n.findChildBounded(path[paramEnd:], append(values, path[:paramEnd]), splits)
+			if child == nil || child.handler == nil {
+				continue // No route below this parameter, maybe the next same-level parameter has one.
+			}
+			return child, childValues
 		}
 		if !strings.HasPrefix(path, n.s) { // Node doesn't match beginning of path.
 			continue
 		}
 		if len(path) == len(n.s) { // Node matched until the end of path.
-			return n
+			return n, values
 		}
-		child := n.findChild(path[len(n.s):])
+		child, childValues := n.findChildBounded(path[len(n.s):], values, splits)
 		if child == nil || child.handler == nil {
 			if !n.isRoot && n.isWildcard() { // If node is a wildcard, don't use it when it's root.
-				return n
+				return n, append(values, path[len(n.s):])
 			}
 			continue // No match from children and current node is not a wildcard, maybe there is a parameter in next same-level node.
 		}
-		return child
+		return child, childValues
 	}
-	return nil
+	return nil, values
 }
 
-// sortChildren puts children with most subnodes on top, plain strings before parameters, and parameters with regular expressions before the parameter without.
+// findChildFold works like findChild, but static parts of path are matched case-insensitively (for ASCII letters).
+// The fixed path is appended to buf and returned, with static parts in the case of the route and parameter values untouched.
+func (n *node) findChildFold(path string, buf []byte) (*node, []byte) {
+	splits := maxSplits
+	return n.findChildFoldBounded(path, buf, &splits)
+}
+
+// findChildFoldBounded works like findChildFold, with splits as the number of in-segment splits that can still be tried.
+func (n *node) findChildFoldBounded(path string, buf []byte, splits *int) (*node, []byte) {
+	for _, n = range n.children {
+		if n.isParameter() {
+			paramEnd := strings.IndexByte(path, '/')
+			if paramEnd == 0 || len(path) == 0 { // A parameter can't be empty.
+				continue
+			}
+			if n.delims != "" {
+				segmentEnd := paramEnd
+				if segmentEnd == -1 {
+					segmentEnd = len(path)
+				}
+				for i := segmentEnd - 1; i > 0 && *splits > 0; i-- { // Delimiters follow parameter names, so they are never letters.
+					if strings.IndexByte(n.delims, path[i]) == -1 {
+						continue
+					}
+					if *splits--; !n.accepts(path[:i]) {
+						continue
+					}
+					if child, childFixed := n.findChildFoldBounded(path[i:], append(buf, path[:i]...), splits); child != nil && child.handler != nil {
+						return child, childFixed
+					}
+				}
+			}
+			if paramEnd == -1 { // Path ends with the parameter.
+				if !n.accepts(path) || n.handler == nil {
+					continue
+				}
+				return n, append(buf, path...)
+			}
+			if !n.accepts(path[:paramEnd]) {
+				continue
+			}
+			child, childFixed := n.findChildFoldBounded(path[paramEnd:], append(buf, path[:paramEnd]...), splits)
+			if child == nil || child.handler == nil {
+				continue // No route below this parameter, maybe the next same-level parameter has one.
+			}
+			return child, childFixed
+		}
+		if len(path) < len(n.s) || !equalFoldASCII(path[:len(n.s)], n.s) { // Node doesn't match beginning of path.
+			continue
+		}
+		fixed := append(buf, n.s...)
+		if len(path) == len(n.s) { // Node matched until the end of path.
+			return n, fixed
+		}
+		child, childFixed := n.findChildFoldBounded(path[len(n.s):], fixed, splits)
+		if child == nil || child.handler == nil {
+			if !n.isRoot && n.isWildcard() { // If node is a wildcard, don't use it when it's root.
+				return n, append(fixed, path[len(n.s):]...)
+			}
+			continue // No match from children and current node is not a wildcard, maybe there is a parameter in next same-level node.
+		}
+		return child, childFixed
+	}
+	return nil, buf
+}
+
+// equalFoldASCII tells if a and b (of same length) are equal under ASCII case-folding.
+func equalFoldASCII(a, b string) bool {
+	for i := 0; i < len(a); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		if c := a[i] | 0x20; c < 'a' || c > 'z' || c != b[i]|0x20 {
+			return false
+		}
+	}
+	return true
+}
+
+// sortChildren puts plain strings before parameters, and parameters with constraints or regular expressions before the parameter without.
+// Then, children with most subnodes are on top.
 func (n *node) sortChildren() {
-	sort.Slice(n.children, func(i, j int) bool {
+	sort.SliceStable(n.children, func(i, j int) bool {
 		a := n.children[i]
 		b := n.children[j]
-		return a.isParameter() && b.isParameter() && a.re != nil ||
-			!a.isParameter() && b.isParameter() ||
-			a.countChildren() > b.countChildren()
+		if a.priority() != b.priority() {
+			return a.priority() < b.priority()
+		}
+		return a.countChildren() > b.countChildren()
 	})
 }
+
+// priority returns the matching order of the node kind: plain strings first, then parameters with constraints or regular expressions, and parameters without.
+func (n *node) priority() int {
+	switch {
+	case !n.isParameter():
+		return 0
+	case n.constraint != nil, n.re != nil:
+		return 1
+	}
+	return 2
+}
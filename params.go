@@ -0,0 +1,88 @@
+package router
+
+import (
+	"context"
+	"net/http"
+)
+
+// A Param is a path parameter.
+type Param struct {
+	Name  string // Name is "*" for the wildcard.
+	Value string
+}
+
+// Params are path parameters, in the order of the route pattern.
+type Params []Param
+
+// Get returns the value of the named parameter.
+// Result is empty if parameter doesn't exist.
+func (ps Params) Get(name string) string {
+	v, _ := ps.lookup(name)
+	return v
+}
+
+// lookup returns the value of the named parameter, and tells if it exists.
+func (ps Params) lookup(name string) (string, bool) {
+	for _, p := range ps {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// Parameter returns the value of path parameter.
+// Result is empty if parameter doesn't exist.
+func Parameter(r *http.Request, key string) string {
+	v, _ := lookupParameter(r, key)
+	return v
+}
+
+// lookupParameter returns the value of path parameter, and tells if it exists.
+func lookupParameter(r *http.Request, key string) (string, bool) {
+	if c, ok := r.Context().Value(contextKeyParams).(*paramsContext); ok {
+		return c.params.lookup(key)
+	}
+	return "", false
+}
+
+// Parameters returns all the path parameters, in the order of the route pattern (the wildcard being the last one).
+// Result is nil if the route has no parameters.
+func Parameters(r *http.Request) Params {
+	if c, ok := r.Context().Value(contextKeyParams).(*paramsContext); ok && len(c.params) > 0 {
+		return append(Params(nil), c.params...)
+	}
+	return nil
+}
+
+// A paramsContext is the context of a request served by a route having parameters.
+// It holds their values and the copy of the request given to the handler, in a single allocation.
+type paramsContext struct {
+	context.Context
+	params Params
+	buf    [8]Param // buf backs params for most routes.
+	req    http.Request
+}
+
+func (c *paramsContext) Value(key interface{}) interface{} {
+	if key == contextKeyParams {
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+// appendParams appends the parameters of route n to ps, from their values found in the request path.
+// Anonymous parameters are skipped, and the wildcard value may be missing when it's empty.
+func (n *node) appendParams(ps Params, values []string) Params {
+	for i, name := range n.params {
+		if name == "" {
+			continue
+		}
+		var v string
+		if i < len(values) {
+			v = values[i]
+		}
+		ps = append(ps, Param{Name: name, Value: v})
+	}
+	return ps
+}
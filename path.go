@@ -0,0 +1,50 @@
+package router
+
+import (
+	"path"
+	"strings"
+)
+
+// isCleanPath tells if p has no empty (but the trailing one), "." or ".." part.
+// A path not beginning with "/" (like "*") is left alone.
+func isCleanPath(p string) bool {
+	if len(p) == 0 || p[0] != '/' {
+		return true
+	}
+	start := 1
+	for i := 1; i <= len(p); i++ {
+		if i < len(p) && p[i] != '/' {
+			continue
+		}
+		switch p[start:i] {
+		case "":
+			if i < len(p) { // Only the trailing part can be empty.
+				return false
+			}
+		case ".", "..":
+			return false
+		}
+		start = i + 1
+	}
+	return true
+}
+
+// cleanPath returns the canonical form of p, like path.Clean does, but keeping the trailing slash as it's significant for routes.
+// A trailing "." or ".." part also leaves a trailing slash, as "/a/b/.." refers to "/a/".
+// As the path is rooted, a ".." can never go above "/".
+//
+// Example:
+//
+//	cleanPath("//users///12") == "/users/12"
+//	cleanPath("/files/../admin/") == "/admin/"
+//	cleanPath("/files/a/..") == "/files/"
+func cleanPath(p string) string {
+	if len(p) == 0 || p[0] != '/' {
+		return p
+	}
+	c := path.Clean(p)
+	if c != "/" && (p[len(p)-1] == '/' || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")) {
+		c += "/"
+	}
+	return c
+}
@@ -0,0 +1,214 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A token is a static text, a parameter or the wildcard of a route path.
+// The static texts keep their "/" so a trailing slash is part of the last one, followed by the wildcard token.
+type token struct {
+	s          string // s is the static text, or the parameter or wildcard name.
+	re         *regexp.Regexp
+	constraint *constraint
+	param      bool
+	optional   bool // optional is set for a trailing parameter that can be missing, with its segment.
+	wildcard   bool
+}
+
+// parsePath checks path and splits it in tokens.
+// A parameter can have a registered constraint instead of a regular expression, like in "/users/:id|int".
+// A parameter taking the last segment is optional when followed by "?", like in "/reports/:year?".
+// A parameter name is made of ASCII letters, digits and "_", so static texts can follow it in the segment, like in "/files/:name.:ext".
+// A wildcard is a trailing slash (named "*") or a trailing "*name" (like a trailing slash, but named).
+// Parameters can also be written like with http.ServeMux: "{id}" for ":id", "{id:re}" for ":id:re", and a trailing "{name...}" for "*name", but both syntaxes can't be mixed.
+//
+// Example:
+//
+//	parsePath("/users/:id/files/") == []token{{s: "/users/"}, {s: "id", param: true}, {s: "/files/"}, {s: "*", wildcard: true}}
+//	parsePath("/users/{id}/files/{path...}") == []token{{s: "/users/"}, {s: "id", param: true}, {s: "/files/"}, {s: "path", wildcard: true}}
+func parsePath(path string) (tokens []token, err error) {
+	if len(path) == 0 || path[0] != '/' {
+		return nil, &PatternError{Pattern: path, Reason: `must begin with "/"`}
+	}
+	var s, wildcard string
+	var braces, colons bool // Syntaxes used for parameters.
+	names := make(map[string]bool)
+	parts := splitPath(path)
+	for i, part := range parts {
+		s += "/"
+		if len(part) > 1 && part[0] == '{' && part[len(part)-1] == '}' { // ServeMux-style parameter.
+			braces = true
+			part = part[1 : len(part)-1]
+			if part == "$" {
+				return nil, &PatternError{Pattern: path, Reason: `has unsupported "{$}"`}
+			}
+			if strings.HasSuffix(part, "...") { // Wildcard.
+				if i != len(parts)-1 {
+					return nil, &PatternError{Pattern: path, Reason: fmt.Sprintf("has wildcard %q not at the end", "{"+part+"}")}
+				}
+				if i == 0 {
+					return nil, &PatternError{Pattern: path, Reason: "has wildcard at the root"}
+				}
+				if part == "..." {
+					return nil, &PatternError{Pattern: path, Reason: "has anonymous wildcard"}
+				}
+				wildcard = part[:len(part)-3]
+			} else {
+				part = ":" + part
+			}
+		} else if len(part) > 1 && part[0] == '*' { // Named wildcard.
+			colons = true
+			if i != len(parts)-1 {
+				return nil, &PatternError{Pattern: path, Reason: fmt.Sprintf("has wildcard %q not at the end", part)}
+			}
+			if i == 0 {
+				return nil, &PatternError{Pattern: path, Reason: "has wildcard at the root"}
+			}
+			wildcard = part[1:]
+		} else if strings.IndexByte(part, ':') != -1 {
+			colons = true
+		}
+		if braces && colons {
+			return nil, &PatternError{Pattern: path, Reason: "mixes {name} and :name parameters"}
+		}
+		if wildcard != "" {
+			break // The wildcard only follows the trailing slash.
+		}
+		for part != "" { // Parameters and static texts can share the segment.
+			paramStart := strings.IndexByte(part, ':')
+			static := part
+			if paramStart != -1 {
+				static = part[:paramStart]
+			}
+			if strings.ContainsAny(static, "{}") { // Like "/files/{name}.txt", rejected by http.ServeMux too.
+				return nil, &PatternError{Pattern: path, Reason: fmt.Sprintf("has braces in static text %q: a {name} parameter must take the whole segment", static)}
+			}
+			if paramStart == -1 { // Static text until the end of segment.
+				s += part
+				break
+			}
+			tokens = append(tokens, token{s: s + part[:paramStart]})
+			s = ""
+			part = part[paramStart+1:]
+			nameEnd := 0
+			for nameEnd < len(part) && isNameByte(part[nameEnd]) {
+				nameEnd++
+			}
+			t := token{s: part[:nameEnd], param: true}
+			part = part[nameEnd:]
+			if t.s != "" && t.s[0] >= '0' && t.s[0] <= '9' { // Like "/time/12:30", that was static text before in-segment parameters.
+				return nil, &PatternError{Pattern: path, Reason: fmt.Sprintf("has parameter name %q beginning with a digit", t.s)}
+			}
+			if t.s != "" && part != "" && part[0] != '|' && part[0] != ':' && part != "?" { // Static text follows the name.
+				// Unless another parameter follows in the segment, it was part of the name before in-segment parameters: don't silently change its meaning.
+				next := strings.IndexByte(part, ':')
+				if next == -1 || next == len(part)-1 || !isNameByte(part[next+1]) && part[next+1] != '|' {
+					if next == -1 {
+						next = len(part)
+					}
+					return nil, &PatternError{Pattern: path, Reason: fmt.Sprintf("has parameter name %q not made of ASCII letters, digits and %q", t.s+part[:next], "_")}
+				}
+			}
+			if part != "" && part[0] == '|' { // Parameter comes with constraint.
+				nameEnd = 1
+				for nameEnd < len(part) && isNameByte(part[nameEnd]) {
+					nameEnd++
+				}
+				if t.constraint = lookupConstraint(part[1:nameEnd]); t.constraint == nil {
+					return nil, &PatternError{Pattern: path, Reason: fmt.Sprintf("has unknown constraint %q", part[1:nameEnd])}
+				}
+				part = part[nameEnd:]
+				if part != "" && part[0] == ':' {
+					return nil, &PatternError{Pattern: path, Reason: "has both constraint and regular expression"}
+				}
+			}
+			if part == "?" && t.s != "" { // Optional parameter.
+				if paramStart != 0 || i != len(parts)-1 {
+					return nil, &PatternError{Pattern: path, Reason: fmt.Sprintf("has optional parameter %q not taking the last segment", t.s)}
+				}
+				t.optional = true
+				part = ""
+			} else if part != "" && part[0] == ':' { // Parameter comes with regular expression, until the end of segment.
+				res := part[1:]
+				part = ""
+				if res == "" {
+					return nil, &PatternError{Pattern: path, Reason: "has empty regular expression"}
+				}
+				if t.re, err = regexp.Compile(res); err != nil {
+					return nil, &RegexpError{Pattern: path, Regexp: res, Err: err}
+				}
+			} else if t.s == "" && t.constraint == nil {
+				return nil, &PatternError{Pattern: path, Reason: "has anonymous parameter"}
+			}
+			if t.s != "" {
+				if names[t.s] {
+					return nil, &PatternError{Pattern: path, Reason: fmt.Sprintf("has duplicate parameter %q", t.s)}
+				}
+				names[t.s] = true
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	if s != "" {
+		tokens = append(tokens, token{s: s})
+	}
+	if wildcard == "" && path != "/" && isWildcard(path) {
+		wildcard = "*"
+	}
+	if wildcard != "" {
+		if names[wildcard] {
+			return nil, &PatternError{Pattern: path, Reason: fmt.Sprintf("has duplicate parameter %q", wildcard)}
+		}
+		tokens = append(tokens, token{s: wildcard, wildcard: true})
+	}
+	return
+}
+
+// accepts tells if v matches the parameter token constraint or regular expression, if any.
+func (t token) accepts(v string) bool {
+	switch {
+	case t.constraint != nil:
+		return t.constraint.match(v)
+	case t.re != nil:
+		return t.re.MatchString(v)
+	}
+	return true
+}
+
+// shortTokens returns the tokens of the route path without its optional parameter (and the slash before), or nil if it has none.
+//
+// Example:
+//
+//	shortTokens([]token{{s: "/reports/"}, {s: "year", param: true, optional: true}}) == []token{{s: "/reports"}}
+func shortTokens(tokens []token) []token {
+	if !tokens[len(tokens)-1].optional {
+		return nil
+	}
+	tokens = tokens[:len(tokens)-1]
+	last := tokens[len(tokens)-1] // Always a static text ending with "/".
+	last.s = last.s[:len(last.s)-1]
+	short := append([]token(nil), tokens[:len(tokens)-1]...)
+	if last.s != "" {
+		short = append(short, last)
+	}
+	if len(short) == 0 { // Root.
+		short = append(short, token{s: "/"})
+	}
+	return short
+}
+
+// isNameByte tells if c can be part of a parameter name: an ASCII letter, a digit or "_".
+func isNameByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+// splitPattern splits a http.ServeMux-style pattern in its method and path, like "GET /users/{id}".
+func splitPattern(pattern string) (method, path string, err error) {
+	i := strings.IndexAny(pattern, " \t")
+	if i <= 0 {
+		return "", "", &PatternError{Pattern: pattern, Reason: "must begin with a method"}
+	}
+	return pattern[:i], strings.TrimLeft(pattern[i:], " \t"), nil
+}
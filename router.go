@@ -2,10 +2,9 @@
 package router
 
 import (
-	"context"
 	"fmt"
 	"net/http"
-	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -13,98 +12,150 @@ type contextKey int
 
 // Context keys
 const (
-	contextKeyParamsIdx contextKey = iota
-	contextKeyParams
+	contextKeyParams contextKey = iota
 )
 
 // The Router is the main structure of this package.
 type Router struct {
-	NotFoundHandler http.Handler
-	trees           map[string]*node // trees is a map of methods with their path nodes.
+	NotFoundHandler         http.Handler
+	MethodNotAllowedHandler http.Handler        // MethodNotAllowedHandler is used when a route exists for the path, but not for the method. The "Allow" header is already set.
+	GlobalOptionsHandler    http.Handler        // GlobalOptionsHandler is used for OPTIONS requests having no explicit route. The "Allow" header is already set.
+	HandleHEAD              bool                // HandleHEAD makes GET routes serve HEAD requests having no explicit route, without sending the body. It's enabled by New.
+	TrailingSlash           TrailingSlashPolicy // TrailingSlash tells how a request path with a trailing slash is handled when it matches no route.
+	RedirectFixedCase       bool                // RedirectFixedCase makes a request path with no route redirected to the route path matching it case-insensitively (for ASCII letters), if any. Parameter values are left untouched.
+	RedirectFixedPath       bool                // RedirectFixedPath makes a request path with empty, "." or ".." parts redirected to its clean form when it has a route, and not found otherwise. So such a path never reaches a handler (and a ".." never escapes a wildcard).
+	UseOnFallback           bool                // UseOnFallback makes the middlewares set with Use also wrap the responses to requests matching no route: redirects, automatic OPTIONS responses, 405 and 404.
+	SetPathValues           bool                // SetPathValues makes the named parameters and the wildcard also available from the request's PathValue method, like with http.ServeMux. It's enabled by New, and costs 2 more allocations per request having parameters.
+
+	trees       map[string]*node                  // trees is a map of methods with their path nodes.
+	names       map[string]*namedRoute            // names is a map of route names with their route.
+	middlewares []func(http.Handler) http.Handler // middlewares wrap the handlers of the routes made after Use.
+	fallback    http.Handler                      // fallback is serveFallback wrapped by middlewares.
 }
 
+// A TrailingSlashPolicy tells how a request path with a trailing slash is handled when it matches no route.
+type TrailingSlashPolicy int
+
+// Trailing slash policies
+const (
+	TrailingSlashRedirect           TrailingSlashPolicy = iota // TrailingSlashRedirect redirects the client to the path without trailing slash, with status 301. It's the default.
+	TrailingSlashRedirectKeepMethod                            // TrailingSlashRedirectKeepMethod redirects the client to the path without trailing slash, with status 308, so the method and body are preserved.
+	TrailingSlashServe                                         // TrailingSlashServe serves the route of the path without trailing slash, without redirection.
+	TrailingSlashStrict                                        // TrailingSlashStrict makes paths with and without trailing slash distinct.
+)
+
 // New returns a fresh rounting unit.
 func New() *Router {
 	return &Router{
-		trees: make(map[string]*node),
+		HandleHEAD:    true,
+		SetPathValues: true,
+		trees:         make(map[string]*node),
+		names:         make(map[string]*namedRoute),
 	}
 }
 
+// String returns the route trees, sorted by method, for debugging.
 func (rt *Router) String() (s string) {
-	for method, node := range rt.trees {
+	for _, method := range rt.methods() {
 		s += method + "\n"
-		for _, n := range node.children {
+		for _, n := range rt.trees[method].children {
 			s += n.string(strings.Repeat(" ", len(method)+1))
 		}
 	}
 	return
 }
 
+// methods returns the sorted methods having a route tree.
+func (rt *Router) methods() []string {
+	methods := make([]string, 0, len(rt.trees))
+	for method := range rt.trees {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Use adds middlewares wrapping the handlers of the routes made afterwards.
+// The first middleware is the outermost one.
+func (rt *Router) Use(middlewares ...func(http.Handler) http.Handler) {
+	rt.middlewares = append(rt.middlewares, middlewares...)
+	rt.fallback = chain(rt.middlewares, http.HandlerFunc(rt.serveFallback))
+}
+
 // Handle adds a route with method, path and handler.
+// The handler is wrapped by the middlewares set with Use.
+// It panics if the path is malformed or if the route already exists (see TryHandle).
 func (rt *Router) Handle(method, path string, handler http.Handler) {
-	if len(path) == 0 || path[0] != '/' {
-		panic(fmt.Errorf("router: path %q must begin with %q", path, "/"))
+	if err := rt.TryHandle(method, path, handler); err != nil {
+		panic(err)
 	}
+}
 
-	// Get (or set) tree for method.
-	n := rt.trees[method]
-	if n == nil {
-		n = new(node)
-		rt.trees[method] = n
-	}
-
-	// Put parameters in their own node.
-	parts := splitPath(path)
-	var s string
-	var params map[string]uint16
-	for i, part := range parts {
-		s += "/"
-		if len(part) > 0 && part[0] == ':' { // It's a parameter.
-			n.makeChild(s, params, nil, nil, (i == 0 && s == "/")) // Make child without ":".
-			part = part[1:]
-			reSep := strings.IndexByte(part, ':') // Search for a name/regexp separator.
-			var re *regexp.Regexp
-			if reSep == -1 { // No regular expression.
-				if part == "" {
-					panic(fmt.Errorf("router: path %q has anonymous parameter", path))
-				}
-				if params == nil {
-					params = make(map[string]uint16)
-				}
-				params[part] = uint16(i) // Store parameter name with part index.
-
-			} else { // Parameter comes with regular expression.
-				if name := part[:reSep]; name != "" {
-					if params == nil {
-						params = make(map[string]uint16)
-					}
-					params[name] = uint16(i) // Store parameter name with part index.
-				}
-				res := part[reSep+1:]
-				if res == "" {
-					panic(fmt.Errorf("router: path %q has empty regular expression", path))
-				}
-				re = regexp.MustCompile(res)
-			}
-			s += ":"               // Only keep colon to represent parameter in tree.
-			if i == len(parts)-1 { // Parameter is the last part: make it with handler.
-				n.makeChild(s, params, re, handler, false)
-			} else {
-				n.makeChild(s, params, re, nil, false)
-			}
-		} else {
-			s += part
-			if i == len(parts)-1 { // Last part: make it with handler.
-				if s != "/" && isWildcard(s) {
-					if params == nil {
-						params = make(map[string]uint16)
-					}
-					params["*"] = uint16(i)
-				}
-				n.makeChild(s, params, nil, handler, (i == 0 && s == "/"))
-			}
+// TryHandle adds a route with method, path and handler, like Handle, but returns an error instead of panicking.
+// The error is a *PatternError or a *RegexpError if the path is malformed, or a *DuplicateRouteError if the route already exists.
+func (rt *Router) TryHandle(method, path string, handler http.Handler) error {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	// Get (or make) tree for method.
+	root := rt.trees[method]
+	if root == nil {
+		root = new(node)
+	}
+	// A route with an optional parameter is also made without it.
+	// Both are checked before changing the tree, so a failure leaves the router untouched.
+	shortTokens := shortTokens(tokens)
+	if n := root.find(tokens); n != nil && n.handler != nil {
+		return &DuplicateRouteError{Method: method, Pattern: path, Existing: n.pattern}
+	}
+	if shortTokens != nil {
+		if n := root.find(shortTokens); n != nil && n.handler != nil {
+			return &DuplicateRouteError{Method: method, Pattern: path, Existing: n.pattern}
+		}
+	}
+	n := root.add(tokens)
+	var short *node
+	if shortTokens != nil {
+		short = root.add(shortTokens)
+	}
+	rt.trees[method] = root
+
+	// Store parameter names in order.
+	for _, t := range tokens {
+		if t.param || t.wildcard {
+			n.params = append(n.params, t.s)
 		}
 	}
+
+	n.handler = chain(rt.middlewares, handler)
+	n.pattern = path
+	if short != nil {
+		short.params = n.params[:len(n.params)-1]
+		short.handler = n.handler
+		short.pattern = path
+	}
+	return nil
+}
+
+// HandleNamed adds a route with method, path and handler, like Handle, and gives it a name to build its URL with Router.URL.
+func (rt *Router) HandleNamed(name, method, path string, handler http.Handler) {
+	if _, ok := rt.names[name]; ok {
+		panic(fmt.Errorf("router: two or more routes are named %q", name))
+	}
+	rt.Handle(method, path, handler)
+	rt.names[name] = newNamedRoute(method, path)
+}
+
+// HandlePattern adds a route from a http.ServeMux-style pattern made of a method and a path, like "GET /users/{id}".
+// It panics if the pattern is malformed or if the route already exists.
+func (rt *Router) HandlePattern(pattern string, handler http.Handler) {
+	method, path, err := splitPattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	rt.Handle(method, path, handler)
 }
 
 // Get makes a route for GET method.
@@ -133,27 +184,107 @@ func (rt *Router) Delete(path string, handler http.Handler) {
 }
 
 func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Remove trailing slash.
-	if len(r.URL.Path) > 1 && r.URL.Path[len(r.URL.Path)-1] == '/' {
-		r.URL.Path = r.URL.Path[:len(r.URL.Path)-1]
-		http.Redirect(w, r, r.URL.String(), http.StatusMovedPermanently)
+	var n *node
+	var head bool
+	var buf [8]string // Parameter values, kept on stack for most routes.
+	values := buf[:0]
+	if !rt.RedirectFixedPath || isCleanPath(r.URL.Path) {
+		n, values, head = rt.route(r.Method, r.URL.Path, values)
+		if n == nil && rt.TrailingSlash == TrailingSlashServe && len(r.URL.Path) > 1 && r.URL.Path[len(r.URL.Path)-1] == '/' {
+			n, values, head = rt.route(r.Method, r.URL.Path[:len(r.URL.Path)-1], buf[:0])
+		}
+	}
+
+	if n == nil {
+		if rt.UseOnFallback && rt.fallback != nil {
+			rt.fallback.ServeHTTP(w, r)
+		} else {
+			rt.serveFallback(w, r)
+		}
 		return
 	}
 
-	// TODO: Handle OPTIONS request.
+	if head {
+		hw := &headResponseWriter{ResponseWriter: w}
+		defer hw.finish()
+		w = hw
+	}
+	// Store parameters in a new context, given with a copy of the request.
+	// Without parameters, the pattern is set on the request itself, like http.ServeMux does, to serve without allocations.
+	if len(n.params) > 0 {
+		c := &paramsContext{Context: r.Context()}
+		c.params = n.appendParams(c.buf[:0], values)
+		c.req = *r.WithContext(c)
+		r = &c.req
+		if rt.SetPathValues {
+			for _, p := range c.params {
+				r.SetPathValue(p.Name, p.Value)
+			}
+		}
+	}
+	r.Pattern = n.pattern
+	n.handler.ServeHTTP(w, r)
+}
+
+// serveFallback responds to a request matching no route, with a redirect, an automatic OPTIONS response, a 405 or a 404.
+func (rt *Router) serveFallback(w http.ResponseWriter, r *http.Request) {
+	if p, code := rt.redirection(r.Method, r.URL.Path); code != 0 {
+		redirect(w, r, p, code)
+		return
+	}
+	if rt.RedirectFixedPath && !isCleanPath(r.URL.Path) {
+		rt.notFound(w, r)
+		return
+	}
 
-	if n := rt.trees[r.Method]; n != nil {
-		n = n.findChild(r.URL.Path)
-		if n != nil && n.handler != nil {
-			// Store parameters in request's context.
-			if n.params != nil {
-				r = r.WithContext(context.WithValue(r.Context(), contextKeyParamsIdx, n.params))
+	if allowed := rt.allowed(r.URL.Path, r.Method); len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		if r.Method == http.MethodOptions { // No explicit OPTIONS route: respond automatically.
+			if rt.GlobalOptionsHandler != nil {
+				rt.GlobalOptionsHandler.ServeHTTP(w, r)
+			} else {
+				w.WriteHeader(http.StatusNoContent)
 			}
-			n.handler.ServeHTTP(w, r)
-			return
+		} else if rt.MethodNotAllowedHandler != nil {
+			rt.MethodNotAllowedHandler.ServeHTTP(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
+		return
 	}
 
+	rt.notFound(w, r)
+}
+
+// redirection returns the path and status code of the redirect answering a request matching no route, for method and path.
+// Code is 0 if there is no redirect, following the fixed path, trailing slash and fixed case policies.
+func (rt *Router) redirection(method, path string) (string, int) {
+	if rt.RedirectFixedPath && !isCleanPath(path) {
+		if p := cleanPath(path); rt.exists(method, p) {
+			return p, redirectCode(method)
+		}
+		return "", 0
+	}
+
+	// Handle trailing slash as there is no route for it.
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		switch rt.TrailingSlash {
+		case TrailingSlashRedirect:
+			return path[:len(path)-1], http.StatusMovedPermanently
+		case TrailingSlashRedirectKeepMethod:
+			return path[:len(path)-1], http.StatusPermanentRedirect
+		}
+	}
+
+	if rt.RedirectFixedCase {
+		if p := rt.fixCase(method, path); p != "" {
+			return p, redirectCode(method)
+		}
+	}
+	return "", 0
+}
+
+func (rt *Router) notFound(w http.ResponseWriter, r *http.Request) {
 	if rt.NotFoundHandler != nil {
 		rt.NotFoundHandler.ServeHTTP(w, r)
 	} else {
@@ -161,35 +292,120 @@ func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Parameter returns the value of path parameter.
-// Result is empty if parameter doesn't exist.
-func Parameter(r *http.Request, key string) string {
-	params, ok := r.Context().Value(contextKeyParams).(map[string]string)
-	if ok { // Parameters already parsed.
-		return params[key]
-	}
-	paramsIdx, ok := r.Context().Value(contextKeyParamsIdx).(map[string]uint16)
-	if !ok {
-		return ""
-	}
-	params = make(map[string]string, len(paramsIdx))
-	parts := splitPath(r.URL.Path)
-	for name, idx := range paramsIdx {
-		switch name {
-		case "*":
-			for idx < uint16(len(parts)) {
-				params[name] += parts[idx]
-				if idx < uint16(len(parts))-1 {
-					params[name] += "/"
-				}
-				idx++
+// fixCase returns the route path matching path case-insensitively, for method.
+// The result is empty if there is no such route.
+func (rt *Router) fixCase(method, path string) string {
+	if n := rt.trees[method]; n != nil {
+		if n, fixed := n.findChildFold(path, make([]byte, 0, len(path))); n != nil && n.handler != nil {
+			return string(fixed)
+		}
+	}
+	if method == http.MethodHead && rt.HandleHEAD {
+		return rt.fixCase(http.MethodGet, path)
+	}
+	return ""
+}
+
+// exists tells if a request for method and path would be served by a route, directly or by following the trailing slash policy.
+func (rt *Router) exists(method, path string) bool {
+	var buf [8]string // Parameter values, kept on stack for most routes.
+	if n, _, _ := rt.route(method, path, buf[:0]); n != nil {
+		return true
+	}
+	if rt.TrailingSlash != TrailingSlashStrict && len(path) > 1 && path[len(path)-1] == '/' {
+		n, _, _ := rt.route(method, path[:len(path)-1], buf[:0])
+		return n != nil
+	}
+	return false
+}
+
+// route returns the node holding the handler for method and path, or nil, with the parameter values appended to values.
+// If HandleHEAD is set and there is no HEAD route, the GET route is returned for a HEAD request and head is true.
+func (rt *Router) route(method, path string, values []string) (n *node, found []string, head bool) {
+	if n, found = rt.match(method, path, values); n != nil {
+		return n, found, false
+	}
+	if method == http.MethodHead && rt.HandleHEAD {
+		if n, found = rt.match(http.MethodGet, path, values); n != nil {
+			return n, found, true
+		}
+	}
+	return nil, values, false
+}
+
+// match returns the node holding the handler for method and path, or nil, with the parameter values appended to values.
+func (rt *Router) match(method, path string, values []string) (*node, []string) {
+	if n := rt.trees[method]; n != nil {
+		if n, values = n.findChild(path, values); n != nil && n.handler != nil {
+			return n, values
+		}
+	}
+	return nil, values
+}
+
+// allowed returns the sorted methods having a route for path, except the skip one.
+// OPTIONS is always part of a non-empty result as it's handled automatically, and so is HEAD with GET when HandleHEAD is set.
+// For the server-wide "*" path, all methods having at least one route are returned.
+func (rt *Router) allowed(path, skip string) (methods []string) {
+	var options, get, head bool
+	var buf [8]string // Parameter values, kept on stack for most routes.
+	for method, n := range rt.trees {
+		if method == skip {
+			continue
+		}
+		if path == "*" {
+			if len(n.children) == 0 {
+				continue
 			}
-		default:
-			params[name] = parts[idx]
+		} else if n, _ = n.findChild(path, buf[:0]); n == nil || n.handler == nil {
+			continue
 		}
+		methods = append(methods, method)
+		options = options || method == http.MethodOptions
+		get = get || method == http.MethodGet
+		head = head || method == http.MethodHead
+	}
+	if get && !head && rt.HandleHEAD && skip != http.MethodHead {
+		methods = append(methods, http.MethodHead)
+	}
+	if len(methods) > 0 && !options {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	return
+}
+
+// chain returns h wrapped by middlewares, the first one being the outermost.
+func chain(middlewares []func(http.Handler) http.Handler, h http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// redirect replies to the request with a redirect to path, keeping the query.
+func redirect(w http.ResponseWriter, r *http.Request, path string, code int) {
+	u := *r.URL
+	u.Path = path
+	u.RawPath = ""
+	http.Redirect(w, r, u.String(), code)
+}
+
+// redirectCode returns the status code of a redirect that makes the client repeat the request with the same method.
+func redirectCode(method string) int {
+	if method == http.MethodGet || method == http.MethodHead {
+		return http.StatusMovedPermanently
 	}
-	*r = *r.WithContext(context.WithValue(r.Context(), contextKeyParams, params))
-	return params[key]
+	return http.StatusPermanentRedirect
+}
+
+// Pattern returns the path of the route matched by the request, as given when making it (like "/users/:id").
+// Result is empty if the request has not been routed.
+//
+// It's also available as the request's Pattern field, like with http.ServeMux.
+// For a route having parameters, it's only set on the copy of the request given to the handler (and the middlewares set with Router.Use).
+func Pattern(r *http.Request) string {
+	return r.Pattern
 }
 
 // isWildcard tells if s ends with '/'.
@@ -200,6 +416,7 @@ func isWildcard(s string) bool {
 // splitPath returns a slice of path parts (divided by '/').
 //
 // Example:
+//
 //	splitPath("/one/two") == []string{"one", "two"}
 //	splitPath("/one/two/") == []string{"one", "two", ""}
 func splitPath(path string) []string {
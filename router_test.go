@@ -1,13 +1,19 @@
 package router
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 type rtTest struct {
@@ -97,9 +103,61 @@ func TestString(t *testing.T) {
 	fmt.Println(rt)
 }
 
+func TestDump(t *testing.T) {
+	rt := New()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rt.Post("/users/:id", h)
+	rt.Get(`/users/:id:^\d+$`, h)
+	rt.Get("/users", h)
+	rt.Get("/", h)
+
+	for i := 0; i < 10; i++ { // Map iteration order must not matter.
+		if want, v := "GET\n"+
+			"    /  http.HandlerFunc  root\n"+
+			"    ∙ users  http.HandlerFunc\n"+
+			"    ∙ ∙∙∙∙∙ /\n"+
+			"    ∙ ∙∙∙∙∙ ∙ :  [id]  ^\\d+$  http.HandlerFunc\n"+
+			"POST\n"+
+			"     /users/\n"+
+			"     ∙∙∙∙∙∙∙ :  [id]  http.HandlerFunc\n", rt.String(); v != want {
+			t.Fatalf("string: want\n%s\ngot\n%s", want, v)
+		}
+	}
+
+	b, err := json.Marshal(rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"GET":[{"s":"/","handler":"http.HandlerFunc","pattern":"/","isRoot":true,"children":[{"s":"users","handler":"http.HandlerFunc","pattern":"/users","children":[{"s":"/","children":[{"s":":","params":["id"],"regexp":"^\\d+$","handler":"http.HandlerFunc","pattern":"/users/:id:^\\d+$"}]}]}]}],` +
+		`"POST":[{"s":"/users/","children":[{"s":":","params":["id"],"handler":"http.HandlerFunc","pattern":"/users/:id"}]}]}`; string(b) != want {
+		t.Errorf("json: want\n%s\ngot\n%s", want, b)
+	}
+
+	if want, v := `digraph router {
+	node [shape=box];
+	n0 [label="GET", shape=ellipse];
+	n1 [label="/\n/\nhttp.HandlerFunc", style=bold];
+	n0 -> n1;
+	n2 [label="users\n/users\nhttp.HandlerFunc", style=bold];
+	n1 -> n2;
+	n3 [label="/"];
+	n2 -> n3;
+	n4 [label=":\n^\\d+$\n/users/:id:^\\d+$\nhttp.HandlerFunc", style=bold];
+	n3 -> n4;
+	n5 [label="POST", shape=ellipse];
+	n6 [label="/users/"];
+	n5 -> n6;
+	n7 [label=":\n/users/:id\nhttp.HandlerFunc", style=bold];
+	n6 -> n7;
+}
+`, rt.DOT(); v != want {
+		t.Errorf("dot: want\n%s\ngot\n%s", want, v)
+	}
+}
+
 func TestFindChild(t *testing.T) {
 	for _, reqt := range reqTests {
-		n := rt.trees[http.MethodGet].findChild(reqt.path)
+		n, _ := rt.trees[http.MethodGet].findChild(reqt.path, nil)
 		if n == nil {
 			if reqt.rtTest != nil {
 				t.Errorf("%q not found", reqt.path)
@@ -151,6 +209,75 @@ func TestParameters(t *testing.T) {
 	rt.ServeHTTP(w, r)
 }
 
+func TestParameterSiblings(t *testing.T) {
+	rt := New()
+	var got string
+	for _, path := range []string{`/a/:x:^\d+$/b`, "/a/:y", `/c/:x:^\d+$/d`, "/c/:y/e"} {
+		path := path
+		rt.Get(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = path
+		}))
+	}
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{path: "/a/5/b", want: `/a/:x:^\d+$/b`},
+		{path: "/a/5", want: "/a/:y"},
+		{path: "/c/5/d", want: `/c/:x:^\d+$/d`},
+		{path: "/c/5/e", want: "/c/:y/e"},
+	} {
+		got = ""
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != http.StatusOK || got != tc.want {
+			t.Errorf("%q: want %q, got %d for %q", tc.path, tc.want, w.Code, got)
+		}
+	}
+}
+
+func TestPattern(t *testing.T) {
+	rt := New()
+	var pattern string
+	rt.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			pattern = Pattern(r)
+		})
+	})
+	for _, path := range []string{"/", "/users", "/users/:id", `/users/:id:^\d+$`, "/users/:id/files/"} {
+		rt.Get(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+	for _, tc := range []struct {
+		path    string
+		pattern string
+	}{
+		{path: "/", pattern: "/"},
+		{path: "/users", pattern: "/users"},
+		{path: "/users/12", pattern: `/users/:id:^\d+$`},
+		{path: "/users/john", pattern: "/users/:id"},
+		{path: "/users/john/files/a/b", pattern: "/users/:id/files/"},
+	} {
+		pattern = ""
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if pattern != tc.pattern {
+			t.Errorf("%q: want %q, got %q", tc.path, tc.pattern, pattern)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+	if allocs := testing.AllocsPerRun(100, func() { rt.ServeHTTP(nopResponseWriter{}, r) }); allocs != 0 {
+		t.Errorf("allocs: want 0, got %v", allocs)
+	}
+}
+
+// nopResponseWriter is a response writer doing nothing, to measure allocations.
+type nopResponseWriter struct{}
+
+func (nopResponseWriter) Header() http.Header         { return nil }
+func (nopResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (nopResponseWriter) WriteHeader(int)             {}
+
 func TestNoParameters(t *testing.T) {
 	rt := New()
 	rt.Get("/user", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -172,6 +299,321 @@ func TestRedirectTrailingSlash(t *testing.T) {
 	}
 }
 
+func TestTrailingSlash(t *testing.T) {
+	rt := New()
+	rt.Get("/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Get("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Get("/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	for _, tc := range []struct {
+		policy   TrailingSlashPolicy
+		path     string
+		status   int
+		location string
+	}{
+		{policy: TrailingSlashRedirect, path: "/users/?page=2", status: http.StatusMovedPermanently, location: "/users?page=2"},
+		{policy: TrailingSlashRedirect, path: "/files/", status: http.StatusAccepted},
+		{policy: TrailingSlashRedirectKeepMethod, path: "/users/12/", status: http.StatusPermanentRedirect, location: "/users/12"},
+		{policy: TrailingSlashServe, path: "/users/", status: http.StatusOK},
+		{policy: TrailingSlashServe, path: "/users/12/", status: http.StatusOK},
+		{policy: TrailingSlashServe, path: "/files/", status: http.StatusAccepted},
+		{policy: TrailingSlashStrict, path: "/users/", status: http.StatusNotFound},
+		{policy: TrailingSlashStrict, path: "/files/", status: http.StatusAccepted},
+	} {
+		rt.TrailingSlash = tc.policy
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.status {
+			t.Errorf("%d %q status: want %d, got %d", tc.policy, tc.path, tc.status, w.Code)
+		}
+		if v := w.Header().Get("Location"); v != tc.location {
+			t.Errorf("%d %q location: want %q, got %q", tc.policy, tc.path, tc.location, v)
+		}
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	for _, tc := range []struct {
+		path  string
+		clean string
+	}{
+		{path: "/", clean: "/"},
+		{path: "*", clean: "*"},
+		{path: "/users/12", clean: "/users/12"},
+		{path: "/users/12/", clean: "/users/12/"},
+		{path: "//users///12", clean: "/users/12"},
+		{path: "/users/./12/", clean: "/users/12/"},
+		{path: "/files/../admin", clean: "/admin"},
+		{path: "/files/../../../admin", clean: "/admin"},
+		{path: "/files/a/..", clean: "/files/"},
+		{path: "/files/a/.", clean: "/files/a/"},
+		{path: "/..", clean: "/"},
+		{path: "/a..b/.c", clean: "/a..b/.c"},
+	} {
+		if v := cleanPath(tc.path); v != tc.clean {
+			t.Errorf("%q: want %q, got %q", tc.path, tc.clean, v)
+		}
+		if v := isCleanPath(tc.path); v != (tc.path == tc.clean) {
+			t.Errorf("%q: want clean %t, got %t", tc.path, tc.path == tc.clean, v)
+		}
+	}
+}
+
+func TestRedirectFixedPath(t *testing.T) {
+	rt := New()
+	rt.RedirectFixedPath = true
+	rt.Get("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Post("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Get("/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{method: http.MethodGet, path: "//users///12?a=b", status: http.StatusMovedPermanently, location: "/users/12?a=b"},
+		{method: http.MethodPost, path: "/files/../users/12", status: http.StatusPermanentRedirect, location: "/users/12"},
+		{method: http.MethodGet, path: "/users/12/./", status: http.StatusMovedPermanently, location: "/users/12/"},
+		{method: http.MethodGet, path: "/files/a/../b", status: http.StatusMovedPermanently, location: "/files/b"},
+		{method: http.MethodGet, path: "/files/../admin", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/files/a/b", status: http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tc.method, "/", nil)
+		r.URL.Path, r.URL.RawQuery = splitQuery(tc.path)
+		rt.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("%s %q status: want %d, got %d", tc.method, tc.path, tc.status, w.Code)
+		}
+		if v := w.Header().Get("Location"); v != tc.location {
+			t.Errorf("%s %q location: want %q, got %q", tc.method, tc.path, tc.location, v)
+		}
+	}
+}
+
+func TestRedirectFixedCase(t *testing.T) {
+	rt := New()
+	rt.RedirectFixedCase = true
+	rt.Get("/users/:id/Files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Get("/users/all", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Get(`/ids/::^\d+$`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{path: "/users/all", status: http.StatusOK},
+		{path: "/Users/ALL?a=b", status: http.StatusMovedPermanently, location: "/users/all?a=b"},
+		{path: "/USERS/John/files/Doc.PDF", status: http.StatusMovedPermanently, location: "/users/John/Files/Doc.PDF"},
+		{path: "/IDS/12", status: http.StatusMovedPermanently, location: "/ids/12"},
+		{path: "/IDS/ab", status: http.StatusNotFound},
+		{path: "/unknown", status: http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.status {
+			t.Errorf("%q status: want %d, got %d", tc.path, tc.status, w.Code)
+		}
+		if v := w.Header().Get("Location"); v != tc.location {
+			t.Errorf("%q location: want %q, got %q", tc.path, tc.location, v)
+		}
+	}
+}
+
+// splitQuery splits a request URI in path and query, without any path cleaning.
+func splitQuery(uri string) (path, query string) {
+	if i := strings.IndexByte(uri, '?'); i != -1 {
+		return uri[:i], uri[i+1:]
+	}
+	return uri, ""
+}
+
+func TestURL(t *testing.T) {
+	rt := New()
+	rt.HandleNamed("home", http.MethodGet, "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.HandleNamed("user", http.MethodGet, `/users/:id:^\d+$`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.HandleNamed("userFile", http.MethodPost, "/users/:id/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.HandleNamed("show", http.MethodGet, `/shows/::^prison-break`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		name   string
+		params []string
+		url    string
+		err    bool
+	}{
+		{name: "home", url: "/"},
+		{name: "user", params: []string{"id", "12"}, url: "/users/12"},
+		{name: "user", params: []string{"id", "john"}, err: true},
+		{name: "user", err: true},
+		{name: "user", params: []string{"id"}, err: true},
+		{name: "user", params: []string{"id", "12", "name", "john"}, err: true},
+		{name: "userFile", params: []string{"id", "john doe", "*", "docs/my cv.pdf"}, url: "/users/john%20doe/files/docs/my%20cv.pdf"},
+		{name: "userFile", params: []string{"id", "12"}, url: "/users/12/files/"},
+		{name: "userFile", params: []string{"id", "a/b"}, err: true},
+		{name: "show", err: true},
+		{name: "unknown", err: true},
+	} {
+		url, err := rt.URL(tc.name, tc.params...)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s %q: want error, got %q", tc.name, tc.params, url)
+			}
+		} else if err != nil {
+			t.Errorf("%s %q: %v", tc.name, tc.params, err)
+		} else if url != tc.url {
+			t.Errorf("%s %q: want %q, got %q", tc.name, tc.params, tc.url, url)
+		}
+	}
+}
+
+func TestDuplicatedNames(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fail()
+		}
+	}()
+	rt := New()
+	rt.HandleNamed("user", http.MethodGet, "/user", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.HandleNamed("user", http.MethodGet, "/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+}
+
+func TestRoutes(t *testing.T) {
+	rt := New()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rt.Post("/users/:id/files/", h)
+	rt.HandleNamed("user", http.MethodGet, `/users/:id:^\d+$`, h)
+	rt.Get("/users", h)
+	rt.Get("/", h)
+	rt.Get(`/shows/::^prison`, h)
+
+	want := []RouteInfo{
+		{Method: http.MethodGet, Pattern: "/"},
+		{Method: http.MethodGet, Pattern: `/shows/::^prison`, Params: []RouteParam{{Regexp: regexp.MustCompile(`^prison`)}}},
+		{Method: http.MethodGet, Pattern: "/users"},
+		{Method: http.MethodGet, Pattern: `/users/:id:^\d+$`, Name: "user", Params: []RouteParam{{Name: "id", Regexp: regexp.MustCompile(`^\d+$`)}}},
+		{Method: http.MethodPost, Pattern: "/users/:id/files/", Params: []RouteParam{{Name: "id"}, {Name: "*"}}},
+	}
+	routes := rt.Routes()
+	if len(routes) != len(want) {
+		t.Fatalf("want %d routes, got %d", len(want), len(routes))
+	}
+	for i, route := range routes {
+		if route.Handler == nil {
+			t.Errorf("%s %s: no handler", route.Method, route.Pattern)
+		}
+		route.Handler = nil
+		if !reflect.DeepEqual(route, want[i]) {
+			t.Errorf("route %d: want %+v, got %+v", i, want[i], route)
+		}
+	}
+
+	errStop := errors.New("stop")
+	var count int
+	if err := rt.Walk(func(RouteInfo) error {
+		count++
+		return errStop
+	}); err != errStop || count != 1 {
+		t.Errorf("walk: want 1 call and error %v, got %d calls and error %v", errStop, count, err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	rt := New()
+	api := rt.Group("/api/")
+	v1 := api.Group("/v1")
+	v1.Get("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "v1")
+	}))
+	v1.Get("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "user "+Parameter(r, "id"))
+	}))
+	v1.Post("/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "file "+Parameter(r, "*"))
+	}))
+	v1.HandleNamed("user", http.MethodPut, "/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodGet, path: "/api/v1", body: "v1"},
+		{method: http.MethodGet, path: "/api/v1/users/12", body: "user 12"},
+		{method: http.MethodPost, path: "/api/v1/files/a/b", body: "file a/b"},
+	} {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if v := w.Body.String(); v != tc.body {
+			t.Errorf("%s %q: want %q, got %q", tc.method, tc.path, tc.body, v)
+		}
+	}
+	if url, err := rt.URL("user", "id", "12"); err != nil || url != "/api/v1/users/12" {
+		t.Errorf("url: want %q, got %q (%v)", "/api/v1/users/12", url, err)
+	}
+}
+
+func TestMiddlewares(t *testing.T) {
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, name+">")
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "handler")
+	})
+	rt := New()
+	rt.Get("/before", h)
+	rt.Use(mw("a"), mw("b"))
+	rt.Get("/", h)
+	api := rt.Group("/api")
+	api.Use(mw("api"))
+	v1 := api.Group("/v1")
+	v1.Use(mw("v1"))
+	v1.Get("/users", h)
+
+	for _, tc := range []struct {
+		path string
+		body string
+	}{
+		{path: "/before", body: "handler"},
+		{path: "/", body: "a>b>handler"},
+		{path: "/api/v1/users", body: "a>b>api>v1>handler"},
+		{path: "/unknown", body: ""},
+	} {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if v := w.Body.String(); v != tc.body {
+			t.Errorf("%q: want %q, got %q", tc.path, tc.body, v)
+		}
+	}
+
+	rt.UseOnFallback = true
+	for _, path := range []string{"/unknown", "/api/v1/users/"} {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if v := w.Body.String(); !strings.HasPrefix(v, "a>b>") {
+			t.Errorf("%q: want %q prefix, got %q", path, "a>b>", v)
+		}
+	}
+}
+
+func TestGroupMissingFirstSlash(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fail()
+		}
+	}()
+	rt := New()
+	rt.Group("/api").Get("users", nil)
+}
+
 func TestMissingFirstSlash(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil {
@@ -217,6 +659,667 @@ func TestEmptyRegexp(t *testing.T) {
 	fmt.Println(rt)
 }
 
+func TestTryHandle(t *testing.T) {
+	rt := New()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if err := rt.TryHandle(http.MethodGet, "/users/:id", h); err != nil {
+		t.Fatal(err)
+	}
+
+	var patternErr *PatternError
+	for _, path := range []string{"", "users", "/:", "/:id:", "/:id/:id"} {
+		if err := rt.TryHandle(http.MethodGet, path, h); !errors.As(err, &patternErr) {
+			t.Errorf("%q: want *PatternError, got %v", path, err)
+		} else if patternErr.Pattern != path {
+			t.Errorf("%q: wrong pattern %q", path, patternErr.Pattern)
+		}
+	}
+
+	var regexpErr *RegexpError
+	if err := rt.TryHandle(http.MethodGet, "/:id:[", h); !errors.As(err, &regexpErr) {
+		t.Errorf("want *RegexpError, got %v", err)
+	} else if regexpErr.Regexp != "[" {
+		t.Errorf("wrong regexp %q", regexpErr.Regexp)
+	}
+
+	var duplicateErr *DuplicateRouteError
+	if err := rt.TryHandle(http.MethodGet, "/users/:name", h); !errors.As(err, &duplicateErr) {
+		t.Errorf("want *DuplicateRouteError, got %v", err)
+	} else if duplicateErr.Existing != "/users/:id" || duplicateErr.Pattern != "/users/:name" {
+		t.Errorf("wrong patterns %q and %q", duplicateErr.Existing, duplicateErr.Pattern)
+	}
+
+	if err := rt.TryHandle(http.MethodPost, "/users/:name", h); err != nil {
+		t.Error(err)
+	}
+	if _, ok := rt.trees[http.MethodPut]; ok {
+		t.Error("failed route must not make a tree")
+	}
+}
+
+func TestServeMuxSyntax(t *testing.T) {
+	rt := New()
+	var ps Params
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ps = Parameters(r)
+	})
+	rt.HandlePattern(`GET /users/{id:^\d+$}/files/{path...}`, h)
+	rt.Group("/shows").HandlePattern("POST /{name}", h)
+
+	for _, tc := range []struct {
+		method, path string
+		want         Params
+	}{
+		{http.MethodGet, "/users/12/files/a/b", Params{{Name: "id", Value: "12"}, {Name: "path", Value: "a/b"}}},
+		{http.MethodPost, "/shows/lost", Params{{Name: "name", Value: "lost"}}},
+	} {
+		ps = nil
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tc.method, tc.path, nil))
+		if !reflect.DeepEqual(ps, tc.want) {
+			t.Errorf("%s %s: want %v, got %v", tc.method, tc.path, tc.want, ps)
+		}
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/john/files/a", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("regexp: want status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var patternErr *PatternError
+	for _, path := range []string{"/users/{id}/:name", "/{}", "/{...}", "/{rest...}", "/files/{rest...}/x", "/{$}", "/files/{name}.txt", "/files/x{name}", "/{id", "/id}", "/{a}{b}"} {
+		if err := rt.TryHandle(http.MethodGet, path, h); !errors.As(err, &patternErr) {
+			t.Errorf("%q: want *PatternError, got %v", path, err)
+		}
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("pattern without method: want panic")
+			}
+		}()
+		rt.HandlePattern("/users", h)
+	}()
+}
+
+func TestNamedWildcard(t *testing.T) {
+	rt := New()
+	var ps Params
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ps = Parameters(r)
+	})
+	rt.HandleNamed("file", http.MethodGet, "/users/:id/files/*filepath", h)
+	rt.Get("/static/", h)
+
+	for _, tc := range []struct {
+		path string
+		want Params
+	}{
+		{"/users/12/files/docs/cv.pdf", Params{{Name: "id", Value: "12"}, {Name: "filepath", Value: "docs/cv.pdf"}}},
+		{"/users/12/files/", Params{{Name: "id", Value: "12"}, {Name: "filepath", Value: ""}}},
+		{"/static/app.js", Params{{Name: "*", Value: "app.js"}}},
+	} {
+		ps = nil
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if !reflect.DeepEqual(ps, tc.want) {
+			t.Errorf("%s: want %v, got %v", tc.path, tc.want, ps)
+		}
+	}
+
+	if u, err := rt.URL("file", "id", "12", "filepath", "docs/my cv.pdf"); err != nil || u != "/users/12/files/docs/my%20cv.pdf" {
+		t.Errorf("url: want %q, got %q (%v)", "/users/12/files/docs/my%20cv.pdf", u, err)
+	}
+	if _, err := rt.URL("file", "id", "12", "*", "cv.pdf"); err == nil {
+		t.Error("url with unknown wildcard name: want error")
+	}
+
+	var patternErr *PatternError
+	for _, path := range []string{"/*filepath", "/files/*filepath/x", "/:filepath/*filepath", "/{id}/*rest"} {
+		if err := rt.TryHandle(http.MethodGet, path, h); !errors.As(err, &patternErr) {
+			t.Errorf("%q: want *PatternError, got %v", path, err)
+		}
+	}
+}
+
+func TestSegmentParameters(t *testing.T) {
+	rt := New()
+	var pattern string
+	var ps Params
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pattern, ps = Pattern(r), Parameters(r)
+	})
+	rt.Get("/files/:name", h)
+	rt.Get("/files/:name.:ext", h)
+	rt.HandleNamed("items", http.MethodGet, "/v:version/items", h)
+	rt.Get("/range/:from-:to", h)
+
+	for _, tc := range []struct {
+		path    string
+		pattern string
+		want    Params
+	}{
+		{"/files/cv.pdf", "/files/:name.:ext", Params{{Name: "name", Value: "cv"}, {Name: "ext", Value: "pdf"}}},
+		{"/files/archive.tar.gz", "/files/:name.:ext", Params{{Name: "name", Value: "archive.tar"}, {Name: "ext", Value: "gz"}}},
+		{"/files/readme", "/files/:name", Params{{Name: "name", Value: "readme"}}},
+		{"/files/.profile", "/files/:name", Params{{Name: "name", Value: ".profile"}}},
+		{"/v2/items", "/v:version/items", Params{{Name: "version", Value: "2"}}},
+		{"/range/1-10", "/range/:from-:to", Params{{Name: "from", Value: "1"}, {Name: "to", Value: "10"}}},
+		{"/range/10", "", nil},
+	} {
+		pattern, ps = "", nil
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if pattern != tc.pattern || !reflect.DeepEqual(ps, tc.want) {
+			t.Errorf("%s: want %q %v, got %q %v", tc.path, tc.pattern, tc.want, pattern, ps)
+		}
+	}
+
+	for _, c := range rt.Lint() {
+		t.Errorf("unexpected conflict: %v", c)
+	}
+
+	if u, err := rt.URL("items", "version", "3"); err != nil || u != "/v3/items" {
+		t.Errorf("url: want %q, got %q (%v)", "/v3/items", u, err)
+	}
+
+	rt.RedirectFixedCase = true
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/V2/ITEMS", nil))
+	if want, v := "/v2/items", w.Header().Get("Location"); v != want {
+		t.Errorf("fixed case: want %q, got %q", want, v)
+	}
+
+	// Names taking the whole segment before in-segment parameters are rejected, not reinterpreted.
+	var patternErr *PatternError
+	for _, path := range []string{"/users/:user-id", `/users/:user-id:^\d+$`, "/files/:name.json", "/:a-:", "/time/12:30", "/:2fa"} {
+		if err := rt.TryHandle(http.MethodPost, path, h); !errors.As(err, &patternErr) {
+			t.Errorf("%q: want *PatternError, got %v", path, err)
+		}
+	}
+}
+
+func TestSegmentParametersLongPath(t *testing.T) {
+	rt := New()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rt.Get("/:a-:b-:c-:d", h)
+	rt.Post("/x", h)
+	rt.RedirectFixedCase = true
+
+	if _, ok := rt.Lookup(http.MethodGet, "/w-x-y-z"); !ok {
+		t.Error("short path: want match")
+	}
+	path := "/" + strings.Repeat("x-", 200000) + "/y" // Matches no route, after trying many splits.
+	start := time.Now()
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("long path: want routing in less than 1s, got %v", d)
+	}
+	if w.Code != http.StatusNotFound {
+		t.Errorf("long path: want status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestOptionalParameter(t *testing.T) {
+	rt := New()
+	var pattern, year string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pattern, year = Pattern(r), Parameter(r, "year")
+	})
+	rt.HandleNamed("reports", http.MethodGet, "/reports/:year?", h)
+	rt.HandleNamed("lang", http.MethodGet, "/:lang?", h)
+
+	for _, tc := range []struct {
+		path, pattern, year string
+	}{
+		{"/reports/2024", "/reports/:year?", "2024"},
+		{"/reports", "/reports/:year?", ""},
+		{"/", "/:lang?", ""},
+	} {
+		pattern, year = "", "-"
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if pattern != tc.pattern || year != tc.year {
+			t.Errorf("%s: want %q and %q, got %q and %q", tc.path, tc.pattern, tc.year, pattern, year)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		params []string
+		want   string
+	}{
+		{"reports", []string{"year", "2024"}, "/reports/2024"},
+		{"reports", nil, "/reports"},
+		{"reports", []string{"year", ""}, "/reports"},
+		{"lang", nil, "/"},
+	} {
+		if u, err := rt.URL(tc.name, tc.params...); err != nil || u != tc.want {
+			t.Errorf("url %s %v: want %q, got %q (%v)", tc.name, tc.params, tc.want, u, err)
+		}
+	}
+
+	if routes := rt.Routes(); len(routes) != 2 || !routes[1].Params[0].Optional {
+		t.Errorf("routes: want 2 routes with optional parameters, got %+v", routes)
+	}
+	for _, c := range rt.Lint() {
+		t.Errorf("unexpected conflict: %v", c)
+	}
+
+	var duplicateErr *DuplicateRouteError
+	for _, path := range []string{"/reports", "/reports/:id"} {
+		if err := rt.TryHandle(http.MethodGet, path, h); !errors.As(err, &duplicateErr) {
+			t.Errorf("%q: want *DuplicateRouteError, got %v", path, err)
+		}
+	}
+	rt.Get("/users", h)
+	if err := rt.TryHandle(http.MethodGet, "/users/:id?", h); !errors.As(err, &duplicateErr) || duplicateErr.Existing != "/users" {
+		t.Errorf("want *DuplicateRouteError with /users, got %v", err)
+	}
+	rt.Get("/r", h)
+	rt.Get("/r/:y", h)
+	tree := rt.String()
+	if err := rt.TryHandle(http.MethodGet, "/r/:id|int?", h); !errors.As(err, &duplicateErr) || duplicateErr.Existing != "/r" {
+		t.Errorf("want *DuplicateRouteError with /r, got %v", err)
+	}
+	if s := rt.String(); s != tree {
+		t.Errorf("failed route changed the tree:\n%s\nwant:\n%s", s, tree)
+	}
+	if _, ok := rt.Lookup(http.MethodGet, "/r/5"); !ok {
+		t.Error("failed route broke /r/:y")
+	}
+
+	var patternErr *PatternError
+	for _, path := range []string{"/:id?/x", "/v:version?", "/:id?/"} {
+		if err := rt.TryHandle(http.MethodPost, path, h); !errors.As(err, &patternErr) {
+			t.Errorf("%q: want *PatternError, got %v", path, err)
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	if lookupConstraint("even") == nil { // Constraints are global: tests can run more than once.
+		RegisterConstraint("even", func(v string) bool {
+			return isDigits(v) && (v[len(v)-1]-'0')%2 == 0
+		})
+	}
+	rt := New()
+	var pattern string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pattern = Pattern(r)
+	})
+	for _, path := range []string{
+		"/users/:id|int",
+		"/users/:id|uuid",
+		"/users/:name",
+		"/posts/:slug|slug",
+		"/days/:d|date",
+		"/colors/:n|hex.png",
+		"/numbers/:n|even",
+		"/numbers/:n",
+	} {
+		rt.Get(path, h)
+	}
+
+	for _, tc := range []struct {
+		path, pattern string
+	}{
+		{"/users/12", "/users/:id|int"},
+		{"/users/-12", "/users/:id|int"},
+		{"/users/123e4567-e89b-12d3-a456-426614174000", "/users/:id|uuid"},
+		{"/users/123e4567-e89b-12d3-a456-42661417400", "/users/:name"},
+		{"/users/john", "/users/:name"},
+		{"/posts/hello-world-2", "/posts/:slug|slug"},
+		{"/posts/Hello", ""},
+		{"/posts/hello--world", ""},
+		{"/days/2024-02-29", "/days/:d|date"},
+		{"/days/2024-13-01", ""},
+		{"/colors/ff00AA.png", "/colors/:n|hex.png"},
+		{"/colors/red.png", ""},
+		{"/numbers/12", "/numbers/:n|even"},
+		{"/numbers/13", "/numbers/:n"},
+	} {
+		pattern = ""
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if pattern != tc.pattern {
+			t.Errorf("%s: want %q, got %q", tc.path, tc.pattern, pattern)
+		}
+	}
+
+	// Constrained parameters take some values from the plain ones, by design.
+	for _, c := range rt.Lint() {
+		t.Errorf("unexpected conflict: %v", c)
+	}
+
+	var patternErr *PatternError
+	for _, path := range []string{"/:id|unknown", "/:id|int:^1$"} {
+		if err := rt.TryHandle(http.MethodPost, path, h); !errors.As(err, &patternErr) {
+			t.Errorf("%q: want *PatternError, got %v", path, err)
+		}
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("registering a constraint twice: want panic")
+			}
+		}()
+		RegisterConstraint("int", isInt)
+	}()
+}
+
+// celsius is a type converted with its encoding.TextUnmarshaler implementation.
+type celsius float64
+
+func (c *celsius) UnmarshalText(b []byte) error {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(string(b), "C"), 64)
+	*c = celsius(v)
+	return err
+}
+
+func TestParameterTypes(t *testing.T) {
+	rt := New()
+	var r *http.Request
+	rt.Get("/:int/:bool/:uuid/:temp/:year?", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r = req
+		if v, err := ParameterInt(r, "int"); err != nil || v != -12 {
+			t.Errorf("int: want %v, got %v (%v)", -12, v, err)
+		}
+		if v, err := ParameterInt64(r, "int"); err != nil || v != -12 {
+			t.Errorf("int64: want %v, got %v (%v)", -12, v, err)
+		}
+		if v, err := ParameterBool(r, "bool"); err != nil || !v {
+			t.Errorf("bool: want %v, got %v (%v)", true, v, err)
+		}
+		if v, err := ParameterUUID(r, "uuid"); err != nil || v.String() != "123e4567-e89b-12d3-a456-426614174000" {
+			t.Errorf("uuid: want %v, got %v (%v)", "123e4567-e89b-12d3-a456-426614174000", v, err)
+		}
+		if v, err := ParameterAs[celsius](r, "temp"); err != nil || v != 21.5 {
+			t.Errorf("celsius: want %v, got %v (%v)", 21.5, v, err)
+		}
+		if v, err := ParameterAs[int32](r, "int"); err != nil || v != -12 {
+			t.Errorf("int32: want %v, got %v (%v)", -12, v, err)
+		}
+		if v, err := ParameterAs[float32](r, "int"); err != nil || v != -12 {
+			t.Errorf("float32: want %v, got %v (%v)", -12, v, err)
+		}
+		if _, err := ParameterAs[uint8](r, "int"); !errors.Is(err, strconv.ErrSyntax) {
+			t.Errorf("uint8: want %v, got %v", strconv.ErrSyntax, err)
+		}
+
+		var paramErr *ParameterError
+		if _, err := ParameterUint(r, "int"); !errors.As(err, &paramErr) || !errors.Is(err, strconv.ErrSyntax) {
+			t.Errorf("uint: want *ParameterError for syntax, got %v", err)
+		} else if paramErr.Name != "int" || paramErr.Pattern != "/:int/:bool/:uuid/:temp/:year?" || paramErr.Value != "-12" || paramErr.Type != "uint" {
+			t.Errorf("uint: wrong error %+v", paramErr)
+		}
+		if _, err := ParameterInt(r, "year"); !errors.Is(err, ErrMissingParameter) {
+			t.Errorf("missing: want %v, got %v", ErrMissingParameter, err)
+		}
+	}))
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/-12/true/123E4567-E89B-12D3-A456-426614174000/21.5C", nil))
+	if r == nil {
+		t.Fatal("route not matched")
+	}
+
+	RegisterParser(func(s string) (celsius, error) { return 0, errors.New("no way") })
+	defer RegisterParser[celsius](nil) // Back to the encoding.TextUnmarshaler conversion.
+	rt.Get("/temps/:temp", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ParameterAs[celsius](r, "temp"); err == nil || !strings.Contains(err.Error(), "no way") {
+			t.Errorf("registered parser: want its error, got %v", err)
+		}
+	}))
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/temps/20C", nil))
+}
+
+type bindPage struct {
+	Number int `path:"page"`
+}
+
+type bindParams struct {
+	ID     int64     `path:"id"`
+	Day    time.Time `path:"day"`
+	Temp   celsius   `path:"temp"`
+	Name   string    `path:"name"`
+	Level  uint8     `path:"level"`
+	Ignore string
+	bindPage
+}
+
+func TestBind(t *testing.T) {
+	rt := New()
+	var got bindParams
+	var err error
+	rt.Get("/:id/:day/:temp/:name/:level/:page?", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = bindParams{Ignore: "kept"}
+		err = Bind(r, &got)
+	}))
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/12/2024-02-29/21.5C/john/3/2", nil))
+	want := bindParams{ID: 12, Day: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), Temp: 21.5, Name: "john", Level: 3, Ignore: "kept", bindPage: bindPage{Number: 2}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v (%v)", want, got, err)
+	}
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/x/2024-02-29/21.5C/john/300", nil))
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) {
+		t.Fatalf("want *BindError, got %v", err)
+	}
+	if len(bindErr.Errors) != 2 || bindErr.Errors[0].Field != "ID" || bindErr.Errors[1].Field != "Level" {
+		t.Errorf("want errors for ID and Level, got %v", err)
+	}
+	if !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("want %v in errors, got %v", strconv.ErrRange, err)
+	}
+	if got.Number != 0 {
+		t.Errorf("missing optional parameter: want untouched field, got %d", got.Number)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	rt := New()
+	rt.Get("/users/:id", Typed(func(w http.ResponseWriter, r *http.Request, p struct {
+		ID int `path:"id"`
+	}) {
+		fmt.Fprintf(w, "user #%d", p.ID)
+	}))
+
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/12", nil))
+	if want, v := "user #12", w.Body.String(); v != want {
+		t.Errorf("want %q, got %q", want, v)
+	}
+
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/john", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid parameter: want status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("unsupported field type: want panic when making the handler")
+			}
+		}()
+		Typed(func(w http.ResponseWriter, r *http.Request, p struct {
+			IDs []int `path:"ids"`
+		}) {
+		})
+	}()
+}
+
+func TestParameterSubtrees(t *testing.T) {
+	rt := New()
+	rt.Get(`/users/:id:^\d+$/posts`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "posts of #"+Parameter(r, "id"))
+	}))
+	rt.Get("/users/:name/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "files of "+Parameter(r, "name"))
+	}))
+	for _, tc := range []struct {
+		path string
+		body string
+	}{
+		{path: "/users/12/posts", body: "posts of #12"},
+		{path: "/users/john/files/cv.pdf", body: "files of john"},
+	} {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if v := w.Body.String(); v != tc.body {
+			t.Errorf("%q: want %q, got %q", tc.path, tc.body, v)
+		}
+	}
+}
+
+func TestParametersOrder(t *testing.T) {
+	rt := New()
+	var got Params
+	rt.Get("/users/:id/posts/:post/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = Parameters(r)
+	}))
+	rt.Get("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = Parameters(r)
+	}))
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1/posts/2/files/a/b", nil))
+	want := Params{{Name: "id", Value: "1"}, {Name: "post", Value: "2"}, {Name: "*", Value: "a/b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if v := got.Get("post"); v != "2" {
+		t.Errorf("get: want %q, got %q", "2", v)
+	}
+	if v := got.Get("unknown"); v != "" {
+		t.Errorf("get unknown: want empty, got %q", v)
+	}
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got != nil {
+		t.Errorf("no parameters: want nil, got %v", got)
+	}
+}
+
+func TestParametersAllocs(t *testing.T) {
+	rt := New()
+	var id string
+	rt.Get("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = Parameter(r, "id")
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/users/12", nil)
+	// The parameters context is the only allocation, but setting path values (enabled by New) costs 2 more.
+	for _, tc := range []struct {
+		setPathValues bool
+		allocs        float64
+	}{
+		{setPathValues: true, allocs: 3},
+		{setPathValues: false, allocs: 1},
+	} {
+		rt.SetPathValues = tc.setPathValues
+		if allocs := testing.AllocsPerRun(100, func() { rt.ServeHTTP(nopResponseWriter{}, r) }); allocs != tc.allocs {
+			t.Errorf("allocs with SetPathValues %v: want %v, got %v", tc.setPathValues, tc.allocs, allocs)
+		}
+	}
+	if id != "12" {
+		t.Errorf("id: want %q, got %q", "12", id)
+	}
+	if r.Context().Value(contextKeyParams) != nil || r.PathValue("id") != "" {
+		t.Error("request given to ServeHTTP has been modified")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { rt.exists(http.MethodGet, "/users/12") }); allocs != 0 {
+		t.Errorf("exists allocs: want 0, got %v", allocs)
+	}
+}
+
+func TestParametersAfterServing(t *testing.T) {
+	rt := New()
+	var kept []*http.Request
+	rt.Get("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kept = append(kept, r)
+	}))
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/2", nil))
+
+	for i, r := range kept {
+		want := strconv.Itoa(i + 1)
+		if v := Parameter(r, "id"); v != want {
+			t.Errorf("request %d: want %q, got %q", i, want, v)
+		}
+		if v := Parameter(r.WithContext(context.WithoutCancel(r.Context())), "id"); v != want {
+			t.Errorf("request %d context: want %q, got %q", i, want, v)
+		}
+		if r.URL == nil || r.URL.Path != "/users/"+want {
+			t.Errorf("request %d: URL has been cleared", i)
+		}
+	}
+}
+
+func TestSetPathValues(t *testing.T) {
+	rt := New()
+	var id, wildcard string
+	rt.Get("/users/:id/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, wildcard = r.PathValue("id"), r.PathValue("*")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/users/12/files/a/b", nil)
+	rt.ServeHTTP(httptest.NewRecorder(), r)
+	if id != "12" || wildcard != "a/b" {
+		t.Errorf("enabled: want %q and %q, got %q and %q", "12", "a/b", id, wildcard)
+	}
+	if v := r.PathValue("id"); v != "" {
+		t.Errorf("request given to ServeHTTP has been modified: path value %q", v)
+	}
+
+	rt.SetPathValues = false
+	id, wildcard = "", ""
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/12/files/a/b", nil))
+	if id != "" || wildcard != "" {
+		t.Errorf("disabled: want empty path values, got %q and %q", id, wildcard)
+	}
+}
+
+func TestLint(t *testing.T) {
+	for _, c := range rt.Lint() {
+		t.Errorf("unexpected conflict: %v", c)
+	}
+
+	rt := New()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rt.Get("/a/:any:.+/x", h)
+	rt.Get("/a/:name/x", h)
+	rt.Get(`/b/:id:^\d+$/x`, h)
+	rt.Get("/b/:name/y", h)
+	rt.Get("/b/1/y", h)
+	rt.Get("/c/", h)
+	rt.Get("/c/:any:^.+$/x", h)
+	rt.Get("/c/:name/y", h)
+	rt.Post("/d/:any:^.*$/x", h)
+	rt.Post("/d/:name/y", h)
+	rt.Post(`/e/:id:^\d+$|^me$`, h)
+	rt.Get(`/f/:id:^\d+$`, h)
+	rt.Get("/f/:name", h)
+	rt.Get("/g/:id|int", h)
+	rt.Get(`/g/:n:^-?\d+$`, h)
+	rt.Get("/k/:id|int", h)
+	rt.Get(`/k/:n:^-?\d+(\.\d+)?$`, h)
+	rt.Get(`/h/:a:^\d+$`, h)
+	rt.Get(`/h/:b:^(\d+|x)$`, h)
+	rt.Get("/u/:a-:b-:c-:d-:e-:f-:g-:h", h) // Too many in-segment parameters to match.
+	rt.Get("/w/", h)
+	rt.Get("/w/:a-:b-:c-:d-:e-:f-:g-:h", h)
+
+	want := []Conflict{
+		{Kind: ConflictUnanchoredRegexp, Method: http.MethodGet, Pattern: "/a/:any:.+/x", Regexp: ".+"},
+		{Kind: ConflictShadowedParameter, Method: http.MethodGet, Pattern: "/a/:name/x", Other: "/a/:any:.+/x"},
+		{Kind: ConflictShadowedParameter, Method: http.MethodGet, Pattern: `/g/:n:^-?\d+$`, Other: "/g/:id|int"},
+		{Kind: ConflictOverlappingParameter, Method: http.MethodGet, Pattern: `/h/:b:^(\d+|x)$`, Other: `/h/:a:^\d+$`},
+		{Kind: ConflictOverlappingParameter, Method: http.MethodGet, Pattern: `/k/:n:^-?\d+(\.\d+)?$`, Other: "/k/:id|int"},
+		{Kind: ConflictUnreachable, Method: http.MethodGet, Pattern: "/u/:a-:b-:c-:d-:e-:f-:g-:h"},
+		{Kind: ConflictWildcardEclipse, Method: http.MethodGet, Pattern: "/w/:a-:b-:c-:d-:e-:f-:g-:h", Other: "/w/"},
+	}
+	conflicts := rt.Lint()
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("want\n%v\ngot\n%v", want, conflicts)
+	}
+}
+
 func TestNotFoundHandler(t *testing.T) {
 	status := http.StatusForbidden
 	body := "foobar"
@@ -236,10 +1339,128 @@ func TestNotFoundHandler(t *testing.T) {
 	}
 }
 
+func TestMethodNotAllowed(t *testing.T) {
+	rt := New()
+	rt.Get("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Put("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Delete("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/users/12", nil)
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status: want %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if want, v := "DELETE, GET, HEAD, OPTIONS, PUT", w.Header().Get("Allow"); v != want {
+		t.Errorf("Allow: want %q, got %q", want, v)
+	}
+
+	status := http.StatusTeapot
+	rt.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != status {
+		t.Errorf("status: want %d, got %d", status, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/unknown", nil)
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status: want %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	rt := New()
+	rt.Get("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Put("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Post("/files", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rt.Handle(http.MethodOptions, "/files", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		allow  string
+	}{
+		{path: "/users/12", status: http.StatusNoContent, allow: "GET, HEAD, OPTIONS, PUT"},
+		{path: "/files", status: http.StatusAccepted},
+		{path: "*", status: http.StatusNoContent, allow: "GET, HEAD, OPTIONS, POST, PUT"},
+		{path: "/unknown", status: http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodOptions, "/", nil)
+		r.URL.Path = tc.path
+		rt.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("%q status: want %d, got %d", tc.path, tc.status, w.Code)
+		}
+		if v := w.Header().Get("Allow"); v != tc.allow {
+			t.Errorf("%q Allow: want %q, got %q", tc.path, tc.allow, v)
+		}
+	}
+
+	rt.GlobalOptionsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Methods", w.Header().Get("Allow"))
+		w.WriteHeader(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/users/12", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status: want %d, got %d", http.StatusOK, w.Code)
+	}
+	if want, v := "GET, HEAD, OPTIONS, PUT", w.Header().Get("Access-Control-Allow-Methods"); v != want {
+		t.Errorf("Access-Control-Allow-Methods: want %q, got %q", want, v)
+	}
+}
+
+func TestHEAD(t *testing.T) {
+	rt := New()
+	rt.Get("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-User", Parameter(r, "id"))
+		fmt.Fprint(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/users/12", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status: want %d, got %d", http.StatusOK, w.Code)
+	}
+	if v := w.Header().Get("X-User"); v != "12" {
+		t.Errorf("X-User: want %q, got %q", "12", v)
+	}
+	if v := w.Header().Get("Content-Length"); v != "5" {
+		t.Errorf("Content-Length: want %q, got %q", "5", v)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("body: want empty, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/users/12", nil))
+	if want, v := "GET, HEAD, OPTIONS", w.Header().Get("Allow"); v != want {
+		t.Errorf("Allow: want %q, got %q", want, v)
+	}
+
+	rt.HandleHEAD = false
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/users/12", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status: want %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if want, v := "GET, OPTIONS", w.Header().Get("Allow"); v != want {
+		t.Errorf("Allow: want %q, got %q", want, v)
+	}
+}
+
 func BenchmarkFindRoute(b *testing.B) {
+	var buf [8]string
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		for _, reqt := range reqTests {
-			rt.trees[http.MethodGet].findChild(reqt.path)
+			rt.trees[http.MethodGet].findChild(reqt.path, buf[:0])
 		}
 	}
 }
@@ -253,6 +1474,41 @@ func BenchmarkServeHTTP(b *testing.B) {
 	}
 }
 
+func BenchmarkServeHTTPParameter(b *testing.B) {
+	for _, setPathValues := range []bool{true, false} {
+		b.Run(fmt.Sprintf("SetPathValues=%v", setPathValues), func(b *testing.B) {
+			rt := New()
+			rt.SetPathValues = setPathValues
+			rt.Get("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Parameter(r, "id")
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/users/12", nil)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rt.ServeHTTP(nopResponseWriter{}, r)
+			}
+		})
+	}
+}
+
+func BenchmarkServeHTTPParameters(b *testing.B) {
+	for _, setPathValues := range []bool{true, false} {
+		b.Run(fmt.Sprintf("SetPathValues=%v", setPathValues), func(b *testing.B) {
+			rt := New()
+			rt.SetPathValues = setPathValues
+			rt.Get("/users/:id/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Parameter(r, "id")
+				Parameter(r, "*")
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/users/12/files/a/b", nil)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rt.ServeHTTP(nopResponseWriter{}, r)
+			}
+		})
+	}
+}
+
 func TestSplitPath(t *testing.T) {
 	for _, tc := range splitPathTests {
 		split := splitPath(tc.path)
@@ -279,3 +1535,33 @@ func BenchmarkSplitPathCustom(b *testing.B) {
 		splitPath("/one/two/three/four/five/six/seven")
 	}
 }
+
+func TestLookup(t *testing.T) {
+	rt := New()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rt.Get("/users/:id/files/", h)
+	rt.Put("/users/:id/files/", h)
+	rt.Get("/about", h)
+
+	cases := []struct {
+		method, path string
+		ok           bool
+		want         Match
+	}{
+		{http.MethodGet, "/users/1/files/a/b", true, Match{Pattern: "/users/:id/files/", Params: map[string]string{"id": "1", "*": "a/b"}, Methods: []string{"GET", "HEAD", "OPTIONS", "PUT"}}},
+		{http.MethodHead, "/about", true, Match{Pattern: "/about", Methods: []string{"GET", "HEAD", "OPTIONS"}}},
+		{http.MethodPost, "/about", false, Match{Methods: []string{"GET", "HEAD", "OPTIONS"}}},
+		{http.MethodGet, "/about/", false, Match{Redirect: "/about", RedirectCode: http.StatusMovedPermanently}},
+		{http.MethodGet, "/unknown", false, Match{}},
+	}
+	for _, c := range cases {
+		m, ok := rt.Lookup(c.method, c.path)
+		if ok != (m.Handler != nil) {
+			t.Errorf("%s %s: handler %v for match %t", c.method, c.path, m.Handler, ok)
+		}
+		m.Handler = nil
+		if ok != c.ok || !reflect.DeepEqual(m, c.want) {
+			t.Errorf("%s %s: want %+v (%t), got %+v (%t)", c.method, c.path, c.want, c.ok, m, ok)
+		}
+	}
+}
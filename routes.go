@@ -0,0 +1,66 @@
+package router
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// A RouteInfo describes a route.
+type RouteInfo struct {
+	Method  string
+	Pattern string       // Pattern is the route path, as given when making it.
+	Name    string       // Name is empty if the route is not named.
+	Params  []RouteParam // Params are the path parameters, in order. The wildcard is named "*" unless named in the pattern.
+	Handler http.Handler // Handler is wrapped by the middlewares.
+}
+
+// A RouteParam describes a path parameter.
+type RouteParam struct {
+	Name       string // Name is empty for an anonymous parameter.
+	Regexp     *regexp.Regexp
+	Constraint string // Constraint is the name of the parameter constraint, if any.
+	Optional   bool   // Optional is set for a trailing parameter that can be missing.
+}
+
+// Routes returns all the routes, sorted by method and pattern.
+func (rt *Router) Routes() (routes []RouteInfo) {
+	rt.Walk(func(route RouteInfo) error {
+		routes = append(routes, route)
+		return nil
+	})
+	return
+}
+
+// Walk calls fn for each route, sorted by method and pattern.
+// If fn returns an error, walking stops and the error is returned.
+func (rt *Router) Walk(fn func(RouteInfo) error) error {
+	names := make(map[[2]string]string, len(rt.names)) // Route names by method and pattern.
+	for name, nr := range rt.names {
+		names[[2]string{nr.method, nr.path}] = name
+	}
+
+	for _, method := range rt.methods() {
+		for _, n := range rt.trees[method].sortedRoutes() {
+			route := RouteInfo{
+				Method:  method,
+				Pattern: n.pattern,
+				Name:    names[[2]string{method, n.pattern}],
+				Handler: n.handler,
+			}
+			tokens, _ := parsePath(n.pattern)
+			for _, t := range tokens {
+				if t.param || t.wildcard {
+					rp := RouteParam{Name: t.s, Regexp: t.re, Optional: t.optional}
+					if t.constraint != nil {
+						rp.Constraint = t.constraint.name
+					}
+					route.Params = append(route.Params, rp)
+				}
+			}
+			if err := fn(route); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
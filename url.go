@@ -0,0 +1,101 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// A namedRoute keeps the tokens of a named route path, to build its URL.
+type namedRoute struct {
+	method string
+	path   string
+	tokens []token
+}
+
+// newNamedRoute parses a path already checked by TryHandle.
+func newNamedRoute(method, path string) *namedRoute {
+	tokens, _ := parsePath(path)
+	return &namedRoute{method: method, path: path, tokens: tokens}
+}
+
+// URL returns the path of the route named name, with its parameters filled by params.
+// The params are given as name/value pairs, and the wildcard value can contain "/" (it's named "*" for a trailing slash).
+// An optional parameter can be omitted (or empty) to drop its segment.
+// An error is returned if the route doesn't exist, or if a parameter is missing, unknown, or doesn't match its regular expression.
+//
+// Example:
+//
+//	rt.HandleNamed("userFile", "GET", `/users/:id:^\d+$/files/`, handler)
+//	rt.URL("userFile", "id", "12", "*", "docs/cv.pdf") // "/users/12/files/docs/cv.pdf"
+func (rt *Router) URL(name string, params ...string) (string, error) {
+	nr, ok := rt.names[name]
+	if !ok {
+		return "", fmt.Errorf("router: no route named %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("router: route %q: parameters must be name/value pairs, got %d values", name, len(params))
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	var b strings.Builder
+	var dropped bool
+	for _, t := range nr.tokens {
+		if t.wildcard {
+			for i, s := range strings.Split(values[t.s], "/") {
+				if i > 0 {
+					b.WriteByte('/')
+				}
+				b.WriteString(url.PathEscape(s))
+			}
+			continue
+		}
+		if !t.param {
+			b.WriteString(t.s)
+			continue
+		}
+		if t.s == "" {
+			return "", fmt.Errorf("router: route %q (%s) has an anonymous parameter that can't be filled", name, nr.path)
+		}
+		v, ok := values[t.s]
+		if t.optional && v == "" { // Drop the last segment.
+			dropped = true
+			break
+		}
+		if !ok || v == "" {
+			return "", fmt.Errorf("router: route %q (%s): missing value for parameter %q", name, nr.path, t.s)
+		}
+		if strings.IndexByte(v, '/') != -1 {
+			return "", fmt.Errorf("router: route %q (%s): value %q for parameter %q must not contain %q", name, nr.path, v, t.s, "/")
+		}
+		if t.re != nil && !t.re.MatchString(v) {
+			return "", fmt.Errorf("router: route %q (%s): value %q for parameter %q doesn't match %q", name, nr.path, v, t.s, t.re)
+		}
+		if t.constraint != nil && !t.constraint.match(v) {
+			return "", fmt.Errorf("router: route %q (%s): value %q for parameter %q doesn't match constraint %q", name, nr.path, v, t.s, t.constraint.name)
+		}
+		b.WriteString(url.PathEscape(v))
+	}
+	for i := 0; i < len(params); i += 2 {
+		if !nr.hasParam(params[i]) {
+			return "", fmt.Errorf("router: route %q (%s) has no parameter %q", name, nr.path, params[i])
+		}
+	}
+	if dropped && b.Len() > 1 { // Also drop the slash before the optional parameter, but for the root.
+		return b.String()[:b.Len()-1], nil
+	}
+	return b.String(), nil
+}
+
+// hasParam tells if the route has a parameter (or wildcard) named name.
+func (nr *namedRoute) hasParam(name string) bool {
+	for _, t := range nr.tokens {
+		if (t.param || t.wildcard) && t.s == name {
+			return true
+		}
+	}
+	return false
+}